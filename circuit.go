@@ -0,0 +1,245 @@
+package smartcache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// CircuitState is state of a circuit breaker
+type CircuitState int
+
+const (
+	// CircuitClosed getter is called
+	CircuitClosed CircuitState = iota
+	// CircuitOpen getter is skipped until OpenDuration passed
+	CircuitOpen
+	// CircuitHalfOpen some probe calls are let through to check source is back
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half_open"
+	}
+	return "unknown"
+}
+
+type CircuitConfig struct {
+	// Name of source like redis, mysql. Getters wrapped by same circuit share its state
+	Name string
+	// FailureThreshold is number of failures in a row to open circuit, default 5
+	FailureThreshold int
+	// OpenDuration is time circuit skip getter before probing again, default 10s
+	OpenDuration time.Duration
+	// HalfOpenProbes is number of calls at the same time when half open, default 1
+	HalfOpenProbes int
+	// IsFailure tell error of getter mean source is broken. Other errors like not found are answer of healthy source.
+	// Default is every error except E_not_found, E_no_item_to_get
+	IsFailure func(err error) bool
+}
+
+// defaultIsFailure count all errors as failure except not found
+func defaultIsFailure(err error) bool {
+	return err.Error() != E_not_found && err.Error() != E_no_item_to_get
+}
+
+// CircuitStats is a snapshot of circuit breaker
+type CircuitStats struct {
+	Name     string `json:"name"`
+	State    string `json:"state"`
+	Failures uint64 `json:"failures"`
+	Opens    uint64 `json:"opens"`
+	Rejected uint64 `json:"rejected"`
+}
+
+/**
+Circuit is breaker around a getter source. After FailureThreshold failures in a row it's open,
+wrapped getters return E_circuit_open at once so the next getter of chain is tried.
+After OpenDuration it's half open and let HalfOpenProbes calls check the source,
+one success close it, one failure open it again.
+*/
+type Circuit struct {
+	lock     sync.Mutex
+	config   CircuitConfig
+	state    CircuitState
+	fails    int
+	openedAt time.Time
+	probes   int
+	failures uint64
+	opens    uint64
+	rejected uint64
+}
+
+func NewCircuit(config CircuitConfig) *Circuit {
+	if config.FailureThreshold < 1 {
+		config.FailureThreshold = 5
+	}
+	if config.OpenDuration <= 0 {
+		config.OpenDuration = 10 * time.Second
+	}
+	if config.IsFailure == nil {
+		config.IsFailure = defaultIsFailure
+	}
+	if config.HalfOpenProbes < 1 {
+		config.HalfOpenProbes = 1
+	}
+	return &Circuit{config: config}
+}
+
+// allow tell getter can be called now
+func (c *Circuit) allow() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.state == CircuitOpen && time.Since(c.openedAt) >= c.config.OpenDuration {
+		c.state = CircuitHalfOpen
+		c.probes = 0
+	}
+	switch c.state {
+	case CircuitOpen:
+		c.rejected++
+		return false
+	case CircuitHalfOpen:
+		if c.probes >= c.config.HalfOpenProbes {
+			c.rejected++
+			return false
+		}
+		c.probes++
+	}
+	return true
+}
+
+// done save result of a call allowed
+func (c *Circuit) done(err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.state == CircuitHalfOpen {
+		c.probes--
+	}
+	if err == nil {
+		c.state = CircuitClosed
+		c.fails = 0
+		return
+	}
+	c.failures++
+	c.fails++
+	if c.state == CircuitHalfOpen || c.fails >= c.config.FailureThreshold {
+		c.state = CircuitOpen
+		c.openedAt = time.Now()
+		c.fails = 0
+		c.opens++
+	}
+}
+
+// release free slot of a call allowed without result, state and failures are not changed
+func (c *Circuit) release() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.state == CircuitHalfOpen {
+		c.probes--
+	}
+}
+
+func (c *Circuit) call(ctx context.Context, fn func() (interface{}, error)) (interface{}, error) {
+	if !c.allow() {
+		return nil, errors.New(E_circuit_open)
+	}
+	val, err := fn()
+	if err != nil && ctx.Err() != nil {
+		// cancelled by caller, source is neither wrong nor healthy
+		c.release()
+		return val, err
+	}
+	if err != nil && !c.config.IsFailure(err) {
+		// source answered, it's healthy
+		c.done(nil)
+		return val, err
+	}
+	c.done(err)
+	return val, err
+}
+
+// Getter wrap getter by circuit
+func (c *Circuit) Getter(fn GetterFn) GetterFn {
+	return func(key interface{}) (interface{}, error) {
+		return c.call(context.TODO(), func() (interface{}, error) { return fn(key) })
+	}
+}
+
+// CtxGetter wrap ctx getter by circuit
+func (c *Circuit) CtxGetter(fn CtxGetterFn) CtxGetterFn {
+	return func(ctx context.Context, collection string, key interface{}) (interface{}, error) {
+		return c.call(ctx, func() (interface{}, error) { return fn(ctx, collection, key) })
+	}
+}
+
+// TypedCtxGetter wrap typed ctx getter by circuit
+func TypedCtxGetter[K comparable, V any](c *Circuit, fn TypedCtxGetterFn[K, V]) TypedCtxGetterFn[K, V] {
+	return func(ctx context.Context, key K) (V, error) {
+		var out V
+		val, err := c.call(ctx, func() (interface{}, error) { return fn(ctx, key) })
+		if err != nil {
+			return out, err
+		}
+		out, _ = val.(V)
+		return out, nil
+	}
+}
+
+// TypedGetter wrap typed getter by circuit
+func TypedGetter[K comparable, V any](c *Circuit, fn TypedGetterFn[K, V]) TypedGetterFn[K, V] {
+	return func(key K) (V, error) {
+		var out V
+		val, err := c.call(context.TODO(), func() (interface{}, error) { return fn(key) })
+		if err != nil {
+			return out, err
+		}
+		out, _ = val.(V)
+		return out, nil
+	}
+}
+
+func (c *Circuit) State() CircuitState {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.state == CircuitOpen && time.Since(c.openedAt) >= c.config.OpenDuration {
+		return CircuitHalfOpen
+	}
+	return c.state
+}
+
+func (c *Circuit) Stats() CircuitStats {
+	state := c.State()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return CircuitStats{
+		Name:     c.config.Name,
+		State:    state.String(),
+		Failures: c.failures,
+		Opens:    c.opens,
+		Rejected: c.rejected,
+	}
+}
+
+// Circuit return circuit breaker of name, it's created by config when not existed and shown in engine stats
+func (e *Engine) Circuit(config CircuitConfig) *Circuit {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if c, has := e.circuits[config.Name]; has {
+		return c
+	}
+	c := NewCircuit(config)
+	e.circuits[config.Name] = c
+	return c
+}
+
+// isCircuitOpen tell getter was skipped by open circuit
+func isCircuitOpen(err error) bool {
+	return err != nil && err.Error() == E_circuit_open
+}
@@ -0,0 +1,146 @@
+package smartcache
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuit(t *testing.T) {
+	e := Start(&CollectionConfig{Key: "cb", Capacity: 10, ExpireDuration: 10 * time.Second})
+	var down int32 = 1
+	var redisCalled, dbCalled int32
+	redis := e.Circuit(CircuitConfig{Name: "redis", FailureThreshold: 2, OpenDuration: 100 * time.Millisecond}).Getter(func(i interface{}) (interface{}, error) {
+		atomic.AddInt32(&redisCalled, 1)
+		if atomic.LoadInt32(&down) == 1 {
+			return nil, errors.New("redis down")
+		}
+		return 1, nil
+	})
+	db := func(i interface{}) (interface{}, error) {
+		atomic.AddInt32(&dbCalled, 1)
+		return 2, nil
+	}
+	for i := 0; i < 5; i++ {
+		var out int
+		hit, err := e.Select(context.TODO(), "cb").Get(i, nil, redis, db).Exec(&out)
+		if !hit || err != nil || out != 2 {
+			log.Print(hit, err, out)
+			t.Fail()
+		}
+	}
+	if redisCalled != 2 || dbCalled != 5 {
+		log.Print(redisCalled, dbCalled)
+		t.Fail()
+	}
+	stats := e.Stats().Circuits["redis"]
+	log.Printf("%+v", stats)
+	if stats.State != "open" || stats.Opens != 1 || stats.Rejected != 3 {
+		t.Fail()
+	}
+
+	// half open probe fail, open again
+	time.Sleep(120 * time.Millisecond)
+	var out int
+	e.Select(context.TODO(), "cb").Get(10, nil, redis, db).Exec(&out)
+	if redisCalled != 3 || e.Stats().Circuits["redis"].State != "open" {
+		t.Fail()
+	}
+
+	// half open probe success, closed
+	time.Sleep(120 * time.Millisecond)
+	atomic.StoreInt32(&down, 0)
+	e.Select(context.TODO(), "cb").Get(11, nil, redis, db).Exec(&out)
+	if redisCalled != 4 || out != 1 || e.Stats().Circuits["redis"].State != "closed" {
+		log.Print(redisCalled, out)
+		t.Fail()
+	}
+}
+
+func TestCircuitNoNegative(t *testing.T) {
+	e := Start(&CollectionConfig{Key: "cbneg", Capacity: 10, ExpireDuration: 10 * time.Second, NegativeTTL: time.Minute})
+	c := e.Circuit(CircuitConfig{Name: "src", FailureThreshold: 1, OpenDuration: time.Minute})
+	getter := c.Getter(func(i interface{}) (interface{}, error) {
+		return nil, errors.New("down")
+	})
+	var out int
+	e.Select(context.TODO(), "cbneg").Get("k1", nil, getter).Exec(&out)
+	e.Select(context.TODO(), "cbneg").Get("k2", nil, getter).Exec(&out)
+	col := e.Collection()["cbneg"]
+	// k1 failed by source, k2 skipped by open circuit
+	if !col.data.Contains("k1") || col.data.Contains("k2") {
+		t.Fail()
+	}
+	if col.Stats().LoadFailures != 1 {
+		t.Fail()
+	}
+}
+
+func TestCircuitCancelNeutral(t *testing.T) {
+	e := Start()
+	defer e.Close(context.TODO())
+	c := e.Circuit(CircuitConfig{Name: "cancel", FailureThreshold: 2, OpenDuration: 50 * time.Millisecond})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	getter := c.CtxGetter(func(ctx context.Context, collection string, key interface{}) (interface{}, error) {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, errors.New("down")
+	})
+
+	// cancel in closed state don't reset failures
+	getter(context.Background(), "c", "k")
+	getter(ctx, "c", "cancel")
+	getter(context.Background(), "c", "k")
+	if c.State() != CircuitOpen {
+		log.Print(c.State())
+		t.Fail()
+	}
+
+	// cancelled probe don't close circuit, slot is freed for next probe
+	time.Sleep(60 * time.Millisecond)
+	getter(ctx, "c", "cancel")
+	if c.State() != CircuitHalfOpen {
+		log.Print(c.State())
+		t.Fail()
+	}
+	if _, err := getter(context.Background(), "c", "k"); err == nil || err.Error() == E_circuit_open {
+		log.Print(err)
+		t.Fail()
+	}
+	if c.State() != CircuitOpen {
+		t.Fail()
+	}
+}
+
+func TestCircuitNotFound(t *testing.T) {
+	e := Start()
+	defer e.Close(context.TODO())
+	notFound := func(i interface{}) (interface{}, error) {
+		return nil, errors.New(E_not_found)
+	}
+	c := e.Circuit(CircuitConfig{Name: "nf", FailureThreshold: 2})
+	getter := c.Getter(notFound)
+	for i := 0; i < 5; i++ {
+		getter(i)
+	}
+	if c.State() != CircuitClosed || c.Stats().Failures != 0 {
+		log.Print(c.Stats())
+		t.Fail()
+	}
+
+	// own miss error is marked by IsFailure
+	missing := errors.New("missing")
+	c2 := e.Circuit(CircuitConfig{Name: "nf2", FailureThreshold: 2, IsFailure: func(err error) bool { return err != missing }})
+	getter2 := c2.Getter(func(i interface{}) (interface{}, error) { return nil, missing })
+	for i := 0; i < 5; i++ {
+		getter2(i)
+	}
+	if c2.State() != CircuitClosed {
+		t.Fail()
+	}
+}
@@ -5,9 +5,9 @@ import (
 	"errors"
 	"log"
 	"reflect"
+	"sync"
+	"sync/atomic"
 	"time"
-
-	lru "github.com/hashicorp/golang-lru"
 )
 
 /**
@@ -17,11 +17,37 @@ Save data inmem here
 type CollectionValue struct {
 	Created int64       `json:"created"`
 	Value   interface{} `json:"value"`
+	// Deadline is unix nano time value expired, 0 is never expired
+	Deadline int64 `json:"deadline"`
+	// IdleDeadline is unix nano time value expired when nobody read it, 0 is not used
+	IdleDeadline int64 `json:"idle_deadline"`
+	// refreshAt is unix nano time value is reloaded by refresh ahead when it's read
+	refreshAt int64
+	// size is bytes of value counted by Sizer, 0 is not counted yet
+	size int64
 }
 
 type CollectionKV struct {
 	Key   interface{} `json:"key"`
 	Value interface{} `json:"value"`
+	// TTL of this item, 0 use ExpireDuration of collection, negative is never expired
+	TTL time.Duration `json:"ttl"`
+}
+
+func (v *CollectionValue) isExpired(now int64) bool {
+	if v.Deadline != 0 && now > v.Deadline {
+		return true
+	}
+	idle := atomic.LoadInt64(&v.IdleDeadline)
+	return idle != 0 && now > idle
+}
+
+// touch extend idle deadline when value is read
+func (v *CollectionValue) touch(now int64, idleTimeout time.Duration) {
+	if idleTimeout <= 0 {
+		return
+	}
+	atomic.StoreInt64(&v.IdleDeadline, now+int64(idleTimeout))
 }
 
 type ICollection interface {
@@ -34,19 +60,88 @@ type ICollection interface {
 	Len() int
 	IsKeyExisted(key interface{}) bool
 	GC()
+	Close()
 }
 
 type Collection struct {
-	key            string
-	data           *lru.Cache
-	expireDuration time.Duration
+	key       string
+	data      store
+	tuning    atomic.Value
+	flight    *loadGroup
+	stop      chan struct{}
+	workers   sync.WaitGroup
+	closeOnce sync.Once
+	// stopLock make sure no worker is added after stop closed
+	stopLock     sync.RWMutex
+	hooks        *Hooks
+	engineHooks  *Hooks
+	stats        *collectionStats
+	journal      *journal
+	staleWindow  time.Duration
+	revalidating sync.Map
+	refreshAhead float64
+	loader       []CtxGetterFn
+	refreshQueue chan interface{}
+	retry        *RetryPolicy
+	writeBehind  *writeBehind
+	writeThrough bool
+	maxBytes     int64
+	tuneLock     sync.Mutex
+	gcStop       chan struct{}
+	keyBuilder   KeyBuilder
+	loadTimeout  time.Duration
 }
 
 type CollectionConfig struct {
-	Key            string
-	Capacity       int
+	Key      string
+	Capacity int
+	// ExpireDuration is default ttl of item, 0 is never expired
 	ExpireDuration time.Duration
 	GCInterval     time.Duration
+	// IdleTimeout expire item when nobody read it in this duration, each read extend it.
+	// ExpireDuration or TTL of item still is max lifetime of item.
+	IdleTimeout time.Duration
+	// Shards split collection to many lru segments by key hash, each segment has own lock.
+	// Capacity is divided for segments. 0 or 1 mean one segment.
+	Shards int
+	// Hooks fired when item of this collection changed
+	Hooks *Hooks
+	// Preload fill collection when it's added to engine, collection is usable after preload done
+	Preload        PreloadFn
+	PreloadTimeout time.Duration
+	// LoadTimeout is deadline of ctx getters of sessions receive, default 1 minute.
+	// Load of a key is shared by sessions read it at the same time, so ctx of session don't cancel it
+	LoadTimeout time.Duration
+	// StaleWhileRevalidate keep expired item in this window, session read with getters
+	// return it and refresh it in background
+	StaleWhileRevalidate time.Duration
+	// RefreshAhead reload item by Loader in background when it's read in last fraction of its ttl,
+	// ex 0.2 is last 20% of ttl. Loader work like getterFns of Session.Get
+	RefreshAhead float64
+	Loader       []GetterFn
+	// CtxLoader is Loader receive ctx, it's done when collection closed. They run after Loader
+	CtxLoader        []CtxGetterFn
+	RefreshWorkers   int
+	RefreshQueueSize int
+	// NegativeTTL remember keys no getter can find in this duration, session read them
+	// return E_not_found without calling getters. Upsert of key drop it
+	NegativeTTL time.Duration
+	// Retry is retry policy of getters, setters of sessions, nil is no retry
+	Retry *RetryPolicy
+	// WriteBehind write Upsert, Delete to other storage by background batches, nil is off
+	WriteBehind *WriteBehindConfig
+	// WriteThrough run setters of session before cache is changed, when a setter fail cache is not changed
+	WriteThrough bool
+	// Policy is how item is evicted when collection is full, default PolicyLRU
+	Policy EvictionPolicy
+	// MaxBytes evict items until bytes of all items counted by Sizer is under it, 0 is no limit.
+	// Capacity still limit number of items. Not supported by Policy2Q, PolicyARC.
+	// With Shards, each shard has MaxBytes/Shards, item bigger than it is not cached and Upsert return E_item_too_big
+	MaxBytes int64
+	// Sizer count bytes of item for MaxBytes, default DefaultSizer
+	Sizer Sizer
+	// KeyBuilder build key passed to getters, setters, default is WithKeyBuilder of engine or DefaultKeyBuilder
+	KeyBuilder KeyBuilder
 }
 
 func CreateCollection(config *CollectionConfig) (*Collection, error) {
@@ -56,38 +151,313 @@ func CreateCollection(config *CollectionConfig) (*Collection, error) {
 	if config.Capacity == 0 {
 		config.Capacity = 100
 	}
-	c, err := lru.New(config.Capacity)
+	s := &Collection{
+		key:          config.Key,
+		flight:       newLoadGroup(),
+		hooks:        config.Hooks,
+		stats:        &collectionStats{},
+		staleWindow:  config.StaleWhileRevalidate,
+		stop:         make(chan struct{}),
+		retry:        config.Retry,
+		writeThrough: config.WriteThrough,
+		maxBytes:     config.MaxBytes,
+		keyBuilder:   config.KeyBuilder,
+		loadTimeout:  config.LoadTimeout,
+	}
+	c, err := newStore(config, s.onEvicted)
 	if err != nil {
 		log.Print(config.Capacity, err)
 		return nil, err
 	}
-	s := &Collection{
-		data:           c,
+	s.data = c
+	s.tuning.Store(collectionSettings{
+		capacity:       config.Capacity,
 		expireDuration: config.ExpireDuration,
-		key:            config.Key,
+		idleTimeout:    config.IdleTimeout,
+		negativeTTL:    config.NegativeTTL,
+	})
+	s.setGCInterval(config.GCInterval)
+	s.startRefresh(config)
+	s.startWriteBehind(config.WriteBehind)
+	return s, nil
+}
+
+// startGC run GC each interval until collection closed or stop closed
+func (c *Collection) startGC(interval time.Duration, stop chan struct{}) {
+	c.workers.Add(1)
+	go func() {
+		defer c.workers.Done()
+		tick := time.NewTicker(interval)
+		defer tick.Stop()
+		for {
+			select {
+			case <-tick.C:
+				c.GC()
+			case <-stop:
+				return
+			case <-c.stop:
+				return
+			}
+		}
+	}()
+}
+
+// goWorker run fn in goroutine Close wait for, fn is not run and false is returned when collection closed
+func (c *Collection) goWorker(fn func()) bool {
+	c.stopLock.RLock()
+	defer c.stopLock.RUnlock()
+	select {
+	case <-c.stop:
+		return false
+	default:
+	}
+	c.workers.Add(1)
+	go func() {
+		defer c.workers.Done()
+		fn()
+	}()
+	return true
+}
+
+// Close stop background workers of collection and wait them exit.
+// Data still can read after close.
+func (c *Collection) Close() {
+	c.closeOnce.Do(func() {
+		c.stopLock.Lock()
+		close(c.stop)
+		c.stopLock.Unlock()
+		c.workers.Wait()
+	})
+}
+
+func newStore(config *CollectionConfig, onEvict evictFn) (store, error) {
+	cf := storeConfig{capacity: config.Capacity, policy: config.Policy, onEvict: onEvict}
+	if config.MaxBytes > 0 {
+		if !weighable(config.Policy) {
+			return nil, errors.New(E_max_bytes_not_supported)
+		}
+		sizer := config.Sizer
+		if sizer == nil {
+			sizer = DefaultSizer
+		}
+		cf.maxBytes = config.MaxBytes
+		cf.weigh = func(key, value interface{}) int64 {
+			colValue := value.(*CollectionValue)
+			if colValue.size == 0 {
+				colValue.size = sizer(key, colValue.Value)
+			}
+			return colValue.size
+		}
 	}
-	if config.GCInterval != 0 {
-		tick := time.NewTicker(config.GCInterval)
-		go func() {
-			<-tick.C
-			s.GC()
-		}()
+	if config.Shards > 1 {
+		return newShardedStore(cf, config.Shards)
 	}
-	return s, nil
+	return newSegment(cf)
 }
 
-func (c *Collection) IsKeyExisted(key interface{}) bool {
-	has := c.data.Contains(key)
+// buildKey is key passed to getters and setters
+func (c *Collection) buildKey(key interface{}) interface{} {
+	if c.keyBuilder != nil {
+		return c.keyBuilder(c.key, key)
+	}
+	return DefaultKeyBuilder(c.key, key)
+}
+
+/**
+loadFn return function run getters one by one, first value found is saved to collection.
+When recheck is true and key is existed, getters are not called.
+When remember is true, key no getter can find is saved as not found, background refresh don't set it
+so a failed refresh don't hide value still alive.
+Chain stop when ctx is done and E_cancelled is returned, key is not saved as not found.
+*/
+func (c *Collection) loadFn(ctx context.Context, key interface{}, getterFns []CtxGetterFn, recheck, remember bool) func() (interface{}, error) {
+	return func() (interface{}, error) {
+		if recheck {
+			if val, has := c.get(key); has {
+				return val, nil
+			}
+		}
+		skipped := false
+		for _, f := range getterFns {
+			if ctx.Err() != nil {
+				return nil, errors.New(E_cancelled)
+			}
+			start := time.Now()
+			val, err := f(ctx, c.key, key)
+			if isCircuitOpen(err) {
+				skipped = true
+				continue
+			}
+			c.stats.load(err, time.Since(start))
+			if err != nil {
+				continue
+			}
+			if val != nil {
+				// upsert only fail when it evict other items or value is too big to cache, value loaded is still good
+				c.upsert(key, val, 0, ReasonLoad)
+			}
+			return val, nil
+		}
+		if ctx.Err() != nil {
+			return nil, errors.New(E_cancelled)
+		}
+		// source skipped may have key, so it's not remembered as not found
+		if remember && !skipped {
+			c.saveNegative(key)
+		}
+		return nil, errors.New(E_no_item_to_get)
+	}
+}
+
+// ctxGetters wrap getters to CtxGetterFn, they still receive key built by buildKey
+func (c *Collection) ctxGetters(getterFns []GetterFn) []CtxGetterFn {
+	out := make([]CtxGetterFn, 0, len(getterFns))
+	for _, f := range getterFns {
+		f := f
+		out = append(out, func(ctx context.Context, collection string, key interface{}) (interface{}, error) {
+			return f(c.buildKey(key))
+		})
+	}
+	return out
+}
+
+// ctxSetters wrap setters to CtxSetterFn, they still receive key built by buildKey
+func (c *Collection) ctxSetters(setterFns []SetterFn) []CtxSetterFn {
+	out := make([]CtxSetterFn, 0, len(setterFns))
+	for _, f := range setterFns {
+		f := f
+		out = append(out, func(ctx context.Context, collection string, key, value interface{}) error {
+			return f(c.buildKey(key), value)
+		})
+	}
+	return out
+}
+
+// record write key to journal of engine when it's enabled
+func (c *Collection) record(key interface{}, written *CollectionValue) {
+	if c.journal != nil {
+		c.journal.record(c, key, written)
+	}
+}
+
+// fire call hooks of collection then hooks of engine
+func (c *Collection) fire(reason HookReason, key, value interface{}) {
+	c.hooks.fire(reason, c.key, key, value)
+	c.engineHooks.fire(reason, c.key, key, value)
+}
+
+func (c *Collection) onEvicted(key, value interface{}) {
+	colValue, ok := value.(*CollectionValue)
+	if !ok {
+		// policy don't tell item evicted
+		c.stats.evicted()
+		return
+	}
+	if !colValue.isNegative() {
+		c.stats.evicted()
+		c.fire(ReasonEvict, key, colValue.Value)
+	}
+}
+
+// removeExpired remove key when it still hold expired value
+func (c *Collection) removeExpired(key interface{}, colValue *CollectionValue) {
+	if c.data.Remove(key) && !colValue.isNegative() {
+		c.stats.expired()
+		c.fire(ReasonExpire, key, colValue.Value)
+	}
+}
+
+// newValue wrap value with deadline, ttl 0 use expireDuration of collection
+func (c *Collection) newValue(value interface{}, ttl time.Duration) *CollectionValue {
+	now := time.Now()
+	if ttl == 0 {
+		ttl = c.settings().expireDuration
+	}
+	cvalue := &CollectionValue{
+		Created: now.Unix(),
+		Value:   value,
+	}
+	if ttl > 0 {
+		cvalue.Deadline = now.Add(ttl).UnixNano()
+		cvalue.refreshAt = c.refreshAt(cvalue.Deadline, int64(ttl))
+	}
+	cvalue.touch(now.UnixNano(), c.settings().idleTimeout)
+	return cvalue
+}
+
+// lookup get value of key, expired value is removed and idle deadline of alive value is extended
+func (c *Collection) lookup(key interface{}) (*CollectionValue, bool) {
+	colValue, stale, has := c.lookupStale(key)
+	if stale || (has && colValue.isNegative()) {
+		return nil, false
+	}
+	return colValue, has
+}
+
+// lookupStale is lookup but value expired in stale window is returned with stale true,
+// negative value is returned too
+func (c *Collection) lookupStale(key interface{}) (*CollectionValue, bool, bool) {
+	value, has := c.data.Get(key)
 	if !has {
-		return has
+		return nil, false, false
 	}
-	value, _ := c.data.Get(key)
 	colValue := value.(*CollectionValue)
-	if colValue.Created+int64(c.expireDuration) < time.Now().Unix() {
-		c.data.Remove(key)
-		return false
+	now := time.Now().UnixNano()
+	if c.isDead(colValue, now) {
+		c.removeExpired(key, colValue)
+		return nil, false, false
 	}
-	return true
+	if colValue.isExpired(now) {
+		return colValue, true, true
+	}
+	colValue.touch(now, c.settings().idleTimeout)
+	c.maybeRefresh(key, colValue, now)
+	return colValue, false, true
+}
+
+// isDead is true when value expired and out of stale window, it should be removed
+func (c *Collection) isDead(colValue *CollectionValue, now int64) bool {
+	if colValue.isNegative() {
+		return colValue.isExpired(now)
+	}
+	return colValue.isExpired(now - int64(c.staleWindow))
+}
+
+/**
+revalidate run load in background to refresh stale key, only one refresh for a key at a time.
+Refresh is a worker of collection: it's not started after Close and its ctx is done when collection closed.
+*/
+func (c *Collection) revalidate(key interface{}, newLoad func(ctx context.Context) func() (interface{}, error)) {
+	if _, running := c.revalidating.LoadOrStore(key, struct{}{}); running {
+		return
+	}
+	started := c.goWorker(func() {
+		defer c.revalidating.Delete(key)
+		ctx, cancel := c.stopContext(context.Background())
+		defer cancel()
+		c.flight.do(key, newLoad(ctx))
+	})
+	if !started {
+		c.revalidating.Delete(key)
+	}
+}
+
+// stopContext return ctx of parent which is also done when collection closed
+func (c *Collection) stopContext(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	go func() {
+		select {
+		case <-c.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+func (c *Collection) IsKeyExisted(key interface{}) bool {
+	_, has := c.lookup(key)
+	return has
 }
 
 func (c *Collection) Key() string {
@@ -98,32 +468,63 @@ func (c *Collection) Len() int {
 	return c.data.Len()
 }
 
+// Coalesced is number of loads waited for a same key load run by other caller
+func (c *Collection) Coalesced() uint64 {
+	return c.flight.Coalesced()
+}
+
 // GC remove key expired you need slow run it
 func (c *Collection) GC() error {
 	if c.data.Len() == 0 {
 		return nil
 	}
-	tombs := make([]interface{}, 0, 10)
+	tombs := make([]*CollectionKV, 0, 10)
+	now := time.Now().UnixNano()
 	for _, key := range c.data.Keys() {
-		value, _ := c.data.Get(key)
+		value, has := c.data.Peek(key)
+		if !has {
+			continue
+		}
 		sval := value.(*CollectionValue)
-		if time.Now().Unix() > sval.Created+int64(c.expireDuration.Seconds()) {
-			tombs = append(tombs, key)
+		if c.isDead(sval, now) {
+			tombs = append(tombs, &CollectionKV{Key: key, Value: sval})
 		}
 	}
 
 	for _, tomb := range tombs {
-		c.data.Remove(tomb)
+		c.removeExpired(tomb.Key, tomb.Value.(*CollectionValue))
 	}
 	return nil
 }
 
 func (c *Collection) Upsert(ctx context.Context, key interface{}, value interface{}) error {
-	cvalue := &CollectionValue{
-		Created: time.Now().Unix(),
-		Value:   value,
+	return c.UpsertTTL(ctx, key, value, 0)
+}
+
+// UpsertTTL upsert value with own ttl, ttl 0 use ExpireDuration of collection, negative is never expired
+func (c *Collection) UpsertTTL(ctx context.Context, key interface{}, value interface{}, ttl time.Duration) error {
+	err := c.upsert(key, value, ttl, ReasonSet)
+	if werr := c.queueWrite(ctx, key, value, false); werr != nil {
+		return werr
+	}
+	return err
+}
+
+// upsert add value and fire hook of reason
+func (c *Collection) upsert(key interface{}, value interface{}, ttl time.Duration, reason HookReason) error {
+	cvalue := c.newValue(value, ttl)
+	if !c.data.Fits(key, cvalue) {
+		c.data.Remove(key)
+		if reason == ReasonSet {
+			c.record(key, nil)
+		}
+		return errors.New(E_item_too_big)
 	}
 	ef := c.data.Add(key, cvalue)
+	if reason == ReasonSet {
+		c.record(key, cvalue)
+	}
+	c.fire(reason, key, value)
 	if !ef {
 		return nil
 	}
@@ -133,54 +534,78 @@ func (c *Collection) Upsert(ctx context.Context, key interface{}, value interfac
 func (c *Collection) Upserts(ctx context.Context, in ...*CollectionKV) (int, error) {
 	count := 0
 	for _, item := range in {
-		cvalue := &CollectionValue{
-			Created: time.Now().Unix(),
-			Value:   item.Value,
+		cvalue := c.newValue(item.Value, item.TTL)
+		if c.data.Fits(item.Key, cvalue) {
+			ef := c.data.Add(item.Key, cvalue)
+			c.record(item.Key, cvalue)
+			c.fire(ReasonSet, item.Key, item.Value)
+			if !ef {
+				count++
+			}
+		} else {
+			// too big to keep, old value of key is dropped
+			c.data.Remove(item.Key)
+			c.record(item.Key, nil)
 		}
-		ef := c.data.Add(item.Key, cvalue)
-		if !ef {
-			count++
+		if err := c.queueWrite(ctx, item.Key, item.Value, false); err != nil {
+			return count, err
 		}
 	}
 	return count, nil
 }
 
 func (c *Collection) Delete(ctx context.Context, key interface{}) error {
+	value, _ := c.data.Peek(key)
 	ef := c.data.Remove(key)
+	// key maybe only in other storage, so it's deleted there too
+	if err := c.queueWrite(ctx, key, nil, true); err != nil {
+		return err
+	}
 	if ef {
+		c.record(key, nil)
+		if colValue, ok := value.(*CollectionValue); ok && !colValue.isNegative() {
+			c.fire(ReasonDelete, key, colValue.Value)
+		}
 		return nil
 	}
 	return errors.New(E_remove_problem)
 }
 
 func (c *Collection) Get(ctx context.Context, key interface{}) (interface{}, bool) {
-	value, has := c.data.Get(key)
+	val, has := c.get(key)
+	c.stats.hit(has)
+	return val, has
+}
+
+// get is Get without counting hit or miss
+func (c *Collection) get(key interface{}) (interface{}, bool) {
+	colValue, has := c.lookup(key)
 	if !has {
 		return nil, has
 	}
-	colValue := value.(*CollectionValue)
-	if colValue.Created+int64(c.expireDuration) < time.Now().Unix() {
-		c.data.Remove(key)
-		return nil, false
-	}
 	return colValue.Value, has
 }
 
 func (c *Collection) Iter(ctx context.Context, key interface{}, filtering func(item interface{}, index int)) {
-	value, has := c.data.Get(key)
+	c.stats.hit(c.iter(key, filtering))
+}
+
+// iter is Iter without counting hit or miss, return false when key not existed
+func (c *Collection) iter(key interface{}, filtering func(item interface{}, index int)) bool {
+	colValue, has := c.lookup(key)
 	if !has {
-		return
-	}
-	colValue := value.(*CollectionValue)
-	if colValue.Created+int64(c.expireDuration) < time.Now().Unix() {
-		c.data.Remove(key)
-		return
+		return false
 	}
-	rv := reflect.ValueOf(colValue.Value)
+	iterSlice(colValue.Value, filtering)
+	return true
+}
+
+// iterSlice call filtering for each item when value is a slice
+func iterSlice(value interface{}, filtering func(item interface{}, index int)) {
+	rv := reflect.ValueOf(value)
 	if rv.Kind() != reflect.Slice {
 		return
 	}
-
 	for i := 0; i < rv.Len(); i++ {
 		filtering(rv.Index(i).Interface(), i)
 	}
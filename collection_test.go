@@ -2,8 +2,10 @@ package smartcache
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"reflect"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -111,7 +113,7 @@ func TestCollectionRunUpsertsAndRemove(t *testing.T) {
 	col2 := collections["col2"]
 	colKVs := make([]*CollectionKV, 0, 10)
 	for k, val := range testcaseOfCollection {
-		colKVs = append(colKVs, &CollectionKV{k, val})
+		colKVs = append(colKVs, &CollectionKV{Key: k, Value: val})
 	}
 
 	if c, err := col2.Upserts(context.TODO(), colKVs...); err != nil || c != len(testcaseOfCollection) {
@@ -204,3 +206,213 @@ func TestCollectionDelete(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestCollectionShardedPointerKey(t *testing.T) {
+	type item struct {
+		ID int
+	}
+	col, _ := CreateCollection(&CollectionConfig{Key: "shardptr", Capacity: 100, Shards: 16})
+	defer col.Close()
+	keys := make([]*item, 20)
+	for i := range keys {
+		keys[i] = &item{ID: i}
+		col.Upsert(context.TODO(), keys[i], i)
+	}
+	// key found by address after value it point to changed
+	for i, key := range keys {
+		key.ID += 1000
+		if val, has := col.Get(context.TODO(), key); !has || val != i {
+			log.Print(i, val, has)
+			t.Fail()
+		}
+	}
+}
+
+func TestCollectionSharded(t *testing.T) {
+	col, err := CreateCollection(&CollectionConfig{Key: "sharded", Capacity: 100, ExpireDuration: 2 * time.Second, Shards: 8})
+	if err != nil {
+		log.Print(err)
+		t.Fail()
+	}
+	for i := 0; i < 50; i++ {
+		if err := col.Upsert(context.TODO(), i, i*2); err != nil {
+			log.Print(err)
+			t.Fail()
+		}
+	}
+	col.Upsert(context.TODO(), "key3", []int{1, 2, 3, 4})
+	if col.Len() != 51 || len(col.data.Keys()) != 51 {
+		log.Print(col.Len())
+		t.Fail()
+	}
+	for i := 0; i < 50; i++ {
+		val, has := col.Get(context.TODO(), i)
+		if !has || val.(int) != i*2 {
+			t.Fail()
+		}
+	}
+	count := 0
+	col.Iter(context.TODO(), "key3", func(item interface{}, index int) {
+		count++
+	})
+	if count != 4 {
+		t.Fail()
+	}
+	col.Delete(context.TODO(), 10)
+	if col.IsKeyExisted(10) || col.Len() != 50 {
+		t.Fail()
+	}
+}
+
+func TestCollectionItemTTL(t *testing.T) {
+	col, err := CreateCollection(&CollectionConfig{Key: "ttl", Capacity: 10, ExpireDuration: 10 * time.Second})
+	if err != nil {
+		log.Print(err)
+		t.Fail()
+	}
+	col.UpsertTTL(context.TODO(), "short", "a", 100*time.Millisecond)
+	col.Upsert(context.TODO(), "long", "b")
+	col.Upserts(context.TODO(),
+		&CollectionKV{Key: "short_list", Value: []int{1, 2}, TTL: 100 * time.Millisecond},
+		&CollectionKV{Key: "forever", Value: "c", TTL: -1},
+	)
+	if !col.IsKeyExisted("short") || !col.IsKeyExisted("short_list") {
+		t.Fail()
+	}
+	time.Sleep(200 * time.Millisecond)
+	if _, has := col.Get(context.TODO(), "short"); has {
+		log.Print("short must expired")
+		t.Fail()
+	}
+	count := 0
+	col.Iter(context.TODO(), "short_list", func(item interface{}, index int) {
+		count++
+	})
+	if count != 0 {
+		t.Fail()
+	}
+	if _, has := col.Get(context.TODO(), "long"); !has {
+		t.Fail()
+	}
+	if val, _ := col.data.Peek("forever"); val.(*CollectionValue).Deadline != 0 {
+		t.Fail()
+	}
+}
+
+func TestCollectionGCItemTTL(t *testing.T) {
+	col, _ := CreateCollection(&CollectionConfig{Key: "ttl", Capacity: 10})
+	col.UpsertTTL(context.TODO(), "short", "a", 100*time.Millisecond)
+	col.Upsert(context.TODO(), "no_expire", "b")
+	time.Sleep(200 * time.Millisecond)
+	col.GC()
+	if col.Len() != 1 || !col.IsKeyExisted("no_expire") {
+		log.Print(col.Len())
+		t.Fail()
+	}
+}
+
+func TestCollectionIdleTimeout(t *testing.T) {
+	col, _ := CreateCollection(&CollectionConfig{Key: "idle", Capacity: 10, ExpireDuration: 600 * time.Millisecond, IdleTimeout: 200 * time.Millisecond})
+	col.Upsert(context.TODO(), "hot", "a")
+	col.Upsert(context.TODO(), "cold", "b")
+	for i := 0; i < 3; i++ {
+		time.Sleep(100 * time.Millisecond)
+		if _, has := col.Get(context.TODO(), "hot"); !has {
+			log.Print("hot must alive ", i)
+			t.Fail()
+		}
+	}
+	if col.IsKeyExisted("cold") {
+		log.Print("cold must expired")
+		t.Fail()
+	}
+	// max lifetime still work
+	for i := 0; i < 4; i++ {
+		time.Sleep(100 * time.Millisecond)
+		col.Get(context.TODO(), "hot")
+	}
+	if col.IsKeyExisted("hot") {
+		log.Print("hot must expired by ExpireDuration")
+		t.Fail()
+	}
+}
+
+func TestCollectionRefreshClose(t *testing.T) {
+	started := make(chan struct{}, 1)
+	loader := func(ctx context.Context, collection string, key interface{}) (interface{}, error) {
+		started <- struct{}{}
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	col, _ := CreateCollection(&CollectionConfig{
+		Key:            "refreshclose",
+		Capacity:       10,
+		ExpireDuration: 100 * time.Millisecond,
+		RefreshAhead:   0.9,
+		CtxLoader:      []CtxGetterFn{loader},
+	})
+	col.Upsert(context.TODO(), "k1", "v1")
+	time.Sleep(20 * time.Millisecond)
+	col.Get(context.TODO(), "k1")
+	<-started
+	closed := make(chan struct{})
+	go func() {
+		col.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		log.Print("close wait refresh")
+		t.Fail()
+	}
+}
+
+func TestCollectionRefreshAhead(t *testing.T) {
+	var called int32
+	loader := func(i interface{}) (interface{}, error) {
+		n := atomic.AddInt32(&called, 1)
+		return fmt.Sprintf("%v-%d", i, n), nil
+	}
+	col, _ := CreateCollection(&CollectionConfig{
+		Key:              "refresh",
+		Capacity:         10,
+		ExpireDuration:   200 * time.Millisecond,
+		RefreshAhead:     0.5,
+		Loader:           []GetterFn{loader},
+		RefreshWorkers:   2,
+		RefreshQueueSize: 1,
+	})
+	defer col.Close()
+	col.Upsert(context.TODO(), "k1", "v1")
+	col.Upsert(context.TODO(), "k2", "v2")
+	// not in refresh window yet
+	col.Get(context.TODO(), "k1")
+	time.Sleep(20 * time.Millisecond)
+	if atomic.LoadInt32(&called) != 0 {
+		t.Fail()
+	}
+	time.Sleep(100 * time.Millisecond)
+	for i := 0; i < 10; i++ {
+		col.Get(context.TODO(), "k1")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if atomic.LoadInt32(&called) != 1 {
+		log.Print("refresh once ", called)
+		t.Fail()
+	}
+	// k1 never miss, deadline is extended
+	time.Sleep(100 * time.Millisecond)
+	val, has := col.Get(context.TODO(), "k1")
+	if !has || val != "refresh.k1-1" {
+		log.Print(val, has)
+		t.Fail()
+	}
+	// k2 is not read so not refreshed
+	if col.IsKeyExisted("k2") {
+		t.Fail()
+	}
+	if col.Stats().Refreshes != 1 {
+		t.Fail()
+	}
+}
@@ -0,0 +1,261 @@
+package smartcache
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"time"
+)
+
+// Duration is time.Duration read from config file as string like "10m", or as number of nanoseconds
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		var n int64
+		if err := json.Unmarshal(b, &n); err != nil {
+			return fmt.Errorf("duration must be string like 10m or number: %s", b)
+		}
+		*d = Duration(n)
+		return nil
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+type FileRetryConfig struct {
+	MaxAttempts int      `json:"max_attempts"`
+	Backoff     Duration `json:"backoff"`
+	MaxBackoff  Duration `json:"max_backoff"`
+	Multiplier  float64  `json:"multiplier"`
+	Jitter      float64  `json:"jitter"`
+}
+
+// FileCollectionConfig is a collection in config file, options need code like getters, hooks are not in file
+type FileCollectionConfig struct {
+	Key                  string           `json:"key"`
+	Capacity             int              `json:"capacity"`
+	ExpireDuration       Duration         `json:"ttl"`
+	GCInterval           Duration         `json:"gc_interval"`
+	IdleTimeout          Duration         `json:"idle_timeout"`
+	Shards               int              `json:"shards"`
+	Policy               EvictionPolicy   `json:"policy"`
+	MaxBytes             int64            `json:"max_bytes"`
+	NegativeTTL          Duration         `json:"negative_ttl"`
+	LoadTimeout          Duration         `json:"load_timeout"`
+	StaleWhileRevalidate Duration         `json:"stale_while_revalidate"`
+	WriteThrough         bool             `json:"write_through"`
+	Retry                *FileRetryConfig `json:"retry"`
+}
+
+/**
+FileConfig is content of config file, like:
+
+	{"collections": [{"key": "users", "capacity": 1000, "ttl": "10m", "gc_interval": "1m", "policy": "lfu"}]}
+*/
+type FileConfig struct {
+	Collections []*FileCollectionConfig `json:"collections"`
+}
+
+func (f *FileCollectionConfig) collectionConfig() *CollectionConfig {
+	cf := &CollectionConfig{
+		Key:                  f.Key,
+		Capacity:             f.Capacity,
+		ExpireDuration:       time.Duration(f.ExpireDuration),
+		GCInterval:           time.Duration(f.GCInterval),
+		IdleTimeout:          time.Duration(f.IdleTimeout),
+		Shards:               f.Shards,
+		Policy:               f.Policy,
+		MaxBytes:             f.MaxBytes,
+		NegativeTTL:          time.Duration(f.NegativeTTL),
+		LoadTimeout:          time.Duration(f.LoadTimeout),
+		StaleWhileRevalidate: time.Duration(f.StaleWhileRevalidate),
+		WriteThrough:         f.WriteThrough,
+	}
+	if f.Retry != nil {
+		cf.Retry = &RetryPolicy{
+			MaxAttempts: f.Retry.MaxAttempts,
+			Backoff:     time.Duration(f.Retry.Backoff),
+			MaxBackoff:  time.Duration(f.Retry.MaxBackoff),
+			Multiplier:  f.Retry.Multiplier,
+			Jitter:      f.Retry.Jitter,
+		}
+	}
+	return cf
+}
+
+// readConfigFile read and check config file, return configs of collections
+func readConfigFile(path string) ([]*CollectionConfig, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	fc := &FileConfig{}
+	if err := dec.Decode(fc); err != nil {
+		return nil, fmt.Errorf("config file %s: %v", path, err)
+	}
+	keys := make(map[string]bool, len(fc.Collections))
+	cfs := make([]*CollectionConfig, 0, len(fc.Collections))
+	for _, c := range fc.Collections {
+		if c.Key == "" {
+			return nil, fmt.Errorf("config file %s: %s", path, E_not_found_any_collection_key)
+		}
+		if keys[c.Key] {
+			return nil, fmt.Errorf("config file %s: collection %s is duplicated", path, c.Key)
+		}
+		keys[c.Key] = true
+		cfs = append(cfs, c.collectionConfig())
+	}
+	return cfs, nil
+}
+
+// StartFromFile create engine with collections of JSON config file at path, opts are applied like Start
+func StartFromFile(path string, opts ...Option) (*Engine, error) {
+	cfs, err := readConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+	all := make([]Option, 0, len(opts)+len(cfs))
+	all = append(all, opts...)
+	for _, cf := range cfs {
+		all = append(all, cf)
+	}
+	e, err := newEngine(all...)
+	if err != nil {
+		return nil, err
+	}
+	for _, cf := range cfs {
+		e.fileKeys[cf.Key] = true
+	}
+	return e, nil
+}
+
+/**
+ReloadConfigFile apply config file to running engine: new collections are added,
+collections removed from file are removed, capacity is resized, ttl and GC interval are updated.
+Data of collections is kept. Changes need rebuild collection like policy, shards are logged and skipped.
+Collections not added by file are never removed.
+*/
+func (e *Engine) ReloadConfigFile(path string) error {
+	cfs, err := readConfigFile(path)
+	if err != nil {
+		return err
+	}
+	current := e.CollectionConfig()
+	e.lock.RLock()
+	fileKeys := make(map[string]bool, len(e.fileKeys))
+	for key := range e.fileKeys {
+		fileKeys[key] = true
+	}
+	e.lock.RUnlock()
+
+	inFile := make(map[string]bool, len(cfs))
+	added := make([]*CollectionConfig, 0)
+	for _, cf := range cfs {
+		inFile[cf.Key] = true
+		old, has := current[cf.Key]
+		if !has {
+			added = append(added, cf)
+			continue
+		}
+		if !reloadable(old, cf) {
+			log.Print("config file: collection ", cf.Key, " changed options need restart, skipped")
+			continue
+		}
+		if old.Capacity != cf.Capacity && cf.Capacity > 0 {
+			if _, err := e.ResizeCollection(cf.Key, cf.Capacity); err != nil {
+				return err
+			}
+		}
+		if old.ExpireDuration != cf.ExpireDuration || old.IdleTimeout != cf.IdleTimeout ||
+			old.NegativeTTL != cf.NegativeTTL || old.GCInterval != cf.GCInterval {
+			if err := e.UpdateCollectionConfig(cf); err != nil {
+				return err
+			}
+		}
+	}
+	if err := e.AddCollection(added...); err != nil {
+		return err
+	}
+	for key := range fileKeys {
+		if !inFile[key] {
+			if err := e.RemoveCollection(key); err != nil {
+				log.Print("config file: remove ", key, " ", err)
+			}
+		}
+	}
+	e.lock.Lock()
+	for _, cf := range cfs {
+		e.fileKeys[cf.Key] = true
+	}
+	for key := range fileKeys {
+		if !inFile[key] {
+			delete(e.fileKeys, key)
+		}
+	}
+	e.lock.Unlock()
+	return nil
+}
+
+// reloadable tell options changed from old to cf can be applied to running collection
+func reloadable(old, cf *CollectionConfig) bool {
+	a, b := *old, *cf
+	for _, c := range []*CollectionConfig{&a, &b} {
+		c.Capacity, c.ExpireDuration, c.IdleTimeout, c.NegativeTTL, c.GCInterval = 0, 0, 0, 0, 0
+		// options only set by code are not compared
+		c.Hooks, c.Preload, c.PreloadTimeout, c.Loader, c.WriteBehind = nil, nil, 0, nil, nil
+		c.RefreshAhead, c.RefreshWorkers, c.RefreshQueueSize, c.Sizer = 0, 0, 0, nil
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+/**
+WatchFile check config file each interval and reload it when it's changed.
+Reload error is logged and engine keep running config. Watcher stop when engine closed.
+*/
+func (e *Engine) WatchFile(path string, interval time.Duration) {
+	modTime, size := fileVersion(path)
+	e.watchers.Add(1)
+	go func() {
+		defer e.watchers.Done()
+		tick := time.NewTicker(interval)
+		defer tick.Stop()
+		for {
+			select {
+			case <-tick.C:
+				mt, sz := fileVersion(path)
+				if mt.Equal(modTime) && sz == size {
+					continue
+				}
+				modTime, size = mt, sz
+				if err := e.ReloadConfigFile(path); err != nil {
+					log.Print("config file: reload fail ", err)
+				}
+			case <-e.stop:
+				return
+			}
+		}
+	}()
+}
+
+func fileVersion(path string) (time.Time, int64) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, -1
+	}
+	return info.ModTime(), info.Size()
+}
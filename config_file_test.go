@@ -0,0 +1,104 @@
+package smartcache
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, path, content string) {
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStartFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.json")
+	writeConfigFile(t, path, `{"collections": [
+		{"key": "users", "capacity": 10, "ttl": "10m", "gc_interval": "1m", "policy": "lfu", "retry": {"max_attempts": 3, "backoff": "5ms"}},
+		{"key": "pages", "capacity": 20, "ttl": 1000000000, "shards": 2}
+	]}`)
+	e, err := StartFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close(context.TODO())
+	cfs := e.CollectionConfig()
+	users := cfs["users"]
+	if users == nil || users.Capacity != 10 || users.ExpireDuration != 10*time.Minute || users.Policy != PolicyLFU || users.Retry.Backoff != 5*time.Millisecond {
+		log.Printf("%+v", users)
+		t.Fail()
+	}
+	if cfs["pages"] == nil || cfs["pages"].ExpireDuration != time.Second || cfs["pages"].Shards != 2 {
+		t.Fail()
+	}
+
+	for _, content := range []string{
+		`{"collections": [{"key": "a", "policy": "mru"}]}`,
+		`{"collections": [{"key": "a", "ttl": "ten"}]}`,
+		`{"collections": [{"key": "a"}, {"key": "a"}]}`,
+		`{"collections": [{"key": "a", "capacty": 1}]}`,
+	} {
+		writeConfigFile(t, path, content)
+		if _, err := StartFromFile(path); err == nil {
+			log.Print(content)
+			t.Fail()
+		}
+	}
+	if _, err := StartFromFile(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Fail()
+	}
+}
+
+func TestWatchFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.json")
+	writeConfigFile(t, path, `{"collections": [
+		{"key": "keep", "capacity": 10, "ttl": "10m"},
+		{"key": "drop", "capacity": 10}
+	]}`)
+	e, err := StartFromFile(path, &CollectionConfig{Key: "code", Capacity: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close(context.TODO())
+	e.WatchFile(path, 10*time.Millisecond)
+	for i := 0; i < 5; i++ {
+		e.Select(context.TODO(), "keep").Upsert(i, i)
+	}
+
+	// mtime may not change in same tick of file system, so wait before write
+	time.Sleep(20 * time.Millisecond)
+	writeConfigFile(t, path, `{"collections": [
+		{"key": "keep", "capacity": 3, "ttl": "1m"},
+		{"key": "new", "capacity": 5},
+		{"key": "drop2", "capacity": 5, "shards": 4}
+	]}`)
+	time.Sleep(100 * time.Millisecond)
+	cols := e.Collection()
+	if cols["keep"] == nil || cols["new"] == nil || cols["drop"] != nil || cols["code"] == nil {
+		log.Print(cols)
+		t.Fail()
+	}
+	keep := e.CollectionConfig()["keep"]
+	if keep.Capacity != 3 || keep.ExpireDuration != time.Minute || cols["keep"].Len() != 3 {
+		log.Printf("%+v %d", keep, cols["keep"].Len())
+		t.Fail()
+	}
+	// data not evicted is kept
+	var out int
+	if hit, _ := e.Select(context.TODO(), "keep").Get(4, nil).Exec(&out); !hit || out != 4 {
+		t.Fail()
+	}
+
+	// broken file keep running config
+	time.Sleep(20 * time.Millisecond)
+	writeConfigFile(t, path, `{"collections": [`)
+	time.Sleep(50 * time.Millisecond)
+	if len(e.Collection()) != 4 {
+		log.Print(e.Collection())
+		t.Fail()
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"log"
 	"sync"
+	"sync/atomic"
 )
 
 func init() {
@@ -19,30 +20,103 @@ type Engine struct {
 	mCollection       map[string]*Collection
 	mConfigCollection map[string]*CollectionConfig
 	lock              *sync.RWMutex
+	closed            int32
+	hooks             *Hooks
+	codec             Codec
+	journal           *journal
+	circuits          map[string]*Circuit
+	// keyBuilder is KeyBuilder of collections don't set their own
+	keyBuilder KeyBuilder
+	// preloadParallelism is number of collections preload at the same time
+	preloadParallelism int
+	// afterStart run by Start after all options applied
+	afterStart []func() error
+	// fileKeys is collections added by config file, reload only remove them
+	fileKeys map[string]bool
+	// stop is closed by Close to stop file watchers
+	stop     chan struct{}
+	watchers sync.WaitGroup
 }
 
 type IEngine interface {
 	Select(ctx context.Context, collectionKey string) ICollection
 	AddCollection(cf ...*CollectionConfig) error
+	RemoveCollection(collectionKey string) error
+	ResizeCollection(collectionKey string, capacity int) (int, error)
+	UpdateCollectionConfig(cf *CollectionConfig) error
 	Collection() map[string]*Collection
 	CollectionConfig() map[string]*CollectionConfig
 	Info()
+	Close(ctx context.Context) error
+	Hooks() *Hooks
 }
 
+// Start create engine with collections
 func Start(cfs ...*CollectionConfig) *Engine {
+	opts := make([]Option, 0, len(cfs))
+	for _, cf := range cfs {
+		opts = append(opts, cf)
+	}
+	return StartWithOptions(opts...)
+}
+
+// StartWithOptions create engine with options, a *CollectionConfig option add a collection
+func StartWithOptions(opts ...Option) *Engine {
+	engine, err := newEngine(opts...)
+	if err != nil {
+		log.Panic(err)
+	}
+	return engine
+}
+
+func newEngine(opts ...Option) (*Engine, error) {
 	engine := &Engine{
 		lock:              &sync.RWMutex{},
 		mCollection:       make(map[string]*Collection),
 		mConfigCollection: make(map[string]*CollectionConfig),
+		hooks:             NewHooks(),
+		codec:             GobCodec{},
+		circuits:          make(map[string]*Circuit),
+		fileKeys:          make(map[string]bool),
+		stop:              make(chan struct{}),
+	}
+	// collections added together after engine options, so their preload can run parallel
+	cfs := make([]*CollectionConfig, 0, len(opts))
+	for _, opt := range opts {
+		if cf, ok := opt.(*CollectionConfig); ok {
+			cfs = append(cfs, cf)
+			continue
+		}
+		if err := opt.apply(engine); err != nil {
+			return nil, err
+		}
 	}
 	if err := engine.AddCollection(cfs...); err != nil {
-		log.Panic(err)
+		return nil, err
 	}
-	return engine
+	for _, fn := range engine.afterStart {
+		if err := fn(); err != nil {
+			engine.Close(context.Background())
+			return nil, err
+		}
+	}
+	engine.afterStart = nil
+	if engine.journal != nil {
+		if err := engine.journal.open(); err != nil {
+			engine.Close(context.Background())
+			return nil, err
+		}
+	}
+	return engine, nil
 }
 
 func (e *Engine) Select(ctx context.Context, collectionKey string) *Session {
+	if e.IsClosed() {
+		return createSession(&SessionConfig{ctx: ctx, err: errors.New(E_engine_closed)})
+	}
+	e.lock.RLock()
 	col, has := e.mCollection[collectionKey]
+	e.lock.RUnlock()
 	if !has {
 		// log.Print(E_not_found_any_collection_key)
 		return createSession(&SessionConfig{ctx: ctx, err: errors.New(E_not_found_any_collection_key)})
@@ -50,32 +124,119 @@ func (e *Engine) Select(ctx context.Context, collectionKey string) *Session {
 	return createSession(&SessionConfig{collection: col, ctx: ctx})
 }
 
+// AddCollection create collections and run their Preload, collections are added when all preload done.
+// Collection has same key is replaced and closed
 func (e *Engine) AddCollection(cfs ...*CollectionConfig) error {
 	if len(cfs) == 0 {
 		return nil
 	}
+	cols := make([]*Collection, 0, len(cfs))
+	closeAll := func() {
+		for _, col := range cols {
+			col.Close()
+		}
+	}
 	for _, cf := range cfs {
 		col, err := CreateCollection(cf)
 		if err != nil {
+			closeAll()
 			return err
 		}
-		e.lock.RLock()
+		col.engineHooks = e.hooks
+		col.journal = e.journal
+		if col.keyBuilder == nil {
+			col.keyBuilder = e.keyBuilder
+		}
+		cols = append(cols, col)
+	}
+	if err := e.preload(cols, cfs); err != nil {
+		closeAll()
+		return err
+	}
+	replaced := make([]*Collection, 0)
+	e.lock.Lock()
+	for i, col := range cols {
+		if old, has := e.mCollection[col.key]; has {
+			replaced = append(replaced, old)
+		}
 		e.mCollection[col.key] = col
-		e.mConfigCollection[col.key] = cf
-		e.lock.RUnlock()
+		e.mConfigCollection[col.key] = cfs[i]
+	}
+	e.lock.Unlock()
+	for _, old := range replaced {
+		old.Close()
 	}
 	return nil
 }
 
+// Hooks fired for items of all collections
+func (e *Engine) Hooks() *Hooks {
+	return e.hooks
+}
+
+// Collection return copy of collections map, it's safe to use while collections are added or removed
 func (e *Engine) Collection() map[string]*Collection {
-	return e.mCollection
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	out := make(map[string]*Collection, len(e.mCollection))
+	for key, col := range e.mCollection {
+		out[key] = col
+	}
+	return out
 }
 
+// CollectionConfig return copy of configs map
 func (e *Engine) CollectionConfig() map[string]*CollectionConfig {
-	return e.mConfigCollection
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	out := make(map[string]*CollectionConfig, len(e.mConfigCollection))
+	for key, cf := range e.mConfigCollection {
+		out[key] = cf
+	}
+	return out
 }
 
 func (e *Engine) Info() {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
 	log.Print(len(e.mCollection), e.mCollection)
 	log.Print(len(e.mConfigCollection), e.mConfigCollection)
 }
+
+func (e *Engine) IsClosed() bool {
+	return atomic.LoadInt32(&e.closed) == 1
+}
+
+// Close stop background workers of all collections.
+// Session selected after close return E_engine_closed error.
+func (e *Engine) Close(ctx context.Context) error {
+	if !atomic.CompareAndSwapInt32(&e.closed, 0, 1) {
+		return nil
+	}
+	close(e.stop)
+	e.watchers.Wait()
+	e.lock.RLock()
+	cols := make([]*Collection, 0, len(e.mCollection))
+	for _, col := range e.mCollection {
+		cols = append(cols, col)
+	}
+	e.lock.RUnlock()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, col := range cols {
+			col.Close()
+		}
+		if e.journal != nil {
+			if err := e.journal.close(); err != nil {
+				log.Print("journal: close fail ", err)
+			}
+		}
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -82,3 +82,33 @@ func BenchmarkEngineCachex100000W10g(b *testing.B) {
 	}
 	wg.Wait()
 }
+
+func BenchmarkEngineCacheParallel(b *testing.B) {
+	for _, shards := range []int{1, 4, 32} {
+		e := Start(&CollectionConfig{
+			Key:            "parallel",
+			Capacity:       100000,
+			ExpireDuration: 10 * time.Second,
+			Shards:         shards,
+		})
+		ctx := context.TODO()
+		for i := 0; i < 10000; i++ {
+			e.Select(ctx, "parallel").Upsert(i, fmt.Sprintf("value %d", i))
+		}
+		b.Run(fmt.Sprintf("shards_%d", shards), func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					i++
+					key := i % 10000
+					if i%4 == 0 {
+						e.Select(ctx, "parallel").Upsert(key, "value")
+						continue
+					}
+					var out string
+					e.Select(ctx, "parallel").Get(key, nil).Exec(&out)
+				}
+			})
+		})
+	}
+}
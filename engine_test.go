@@ -4,6 +4,7 @@ import (
 	"context"
 	"log"
 	"reflect"
+	"runtime"
 	"testing"
 	"time"
 )
@@ -172,3 +173,49 @@ func task(ctx context.Context, num int) {
 		log.Print("timeout")
 	}
 }
+
+func TestEngineClose(t *testing.T) {
+	before := runtime.NumGoroutine()
+	e := Start(
+		&CollectionConfig{Key: "gc1", Capacity: 10, ExpireDuration: 100 * time.Millisecond, GCInterval: 50 * time.Millisecond},
+		&CollectionConfig{Key: "gc2", Capacity: 10, ExpireDuration: 100 * time.Millisecond, GCInterval: 50 * time.Millisecond},
+	)
+	e.Select(context.TODO(), "gc1").Upsert("k1", 1)
+	time.Sleep(300 * time.Millisecond)
+	// gc run more than one time
+	e.Select(context.TODO(), "gc1").Upsert("k2", 2)
+	time.Sleep(300 * time.Millisecond)
+	if e.Collection()["gc1"].Len() != 0 {
+		log.Print("gc not run periodic")
+		t.Fail()
+	}
+	if err := e.Close(context.TODO()); err != nil {
+		t.Fail()
+	}
+	time.Sleep(50 * time.Millisecond)
+	if after := runtime.NumGoroutine(); after > before {
+		log.Print("goroutine leak ", before, after)
+		t.Fail()
+	}
+	var out int
+	_, err := e.Select(context.TODO(), "gc1").Get("k1", nil).Exec(&out)
+	if err == nil || err.Error() != E_engine_closed {
+		t.Fail()
+	}
+	if err := e.Select(context.TODO(), "gc1").Upsert("k1", 1); err == nil || err.Error() != E_engine_closed {
+		t.Fail()
+	}
+	// close again is fine
+	if err := e.Close(context.TODO()); err != nil {
+		t.Fail()
+	}
+}
+
+func TestStartConfigSlice(t *testing.T) {
+	cfs := []*CollectionConfig{{Key: "s1", Capacity: 10}, {Key: "s2", Capacity: 10}}
+	e := Start(cfs...)
+	defer e.Close(context.TODO())
+	if len(e.Collection()) != 2 {
+		t.Fail()
+	}
+}
@@ -6,4 +6,13 @@ const (
 	E_remove_problem               = "remove_problem"
 	E_no_item_to_get               = "no_item_to_get"
 	E_cancelled                    = "cancelled"
+	E_engine_closed                = "engine_closed"
+	E_preload_timeout              = "preload_timeout"
+	E_not_found                    = "not_found"
+	E_circuit_open                 = "circuit_open"
+	E_write_queue_full             = "write_queue_full"
+	E_write_behind_closed          = "write_behind_closed"
+	E_max_bytes_not_supported      = "max_bytes_not_supported"
+	E_invalid_capacity             = "invalid_capacity"
+	E_item_too_big                 = "item_too_big"
 )
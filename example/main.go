@@ -4,8 +4,6 @@ import (
 	"context"
 	"errors"
 	"log"
-	"strconv"
-	"strings"
 
 	"github.com/teng231/smartcache"
 )
@@ -15,31 +13,27 @@ type D struct {
 	B int
 }
 
-func getDataFromRedis(cond interface{}) (interface{}, error) {
-	condI := cond.(string)
-	items := strings.Split(condI, ".")
-	id := items[len(items)-1]
-	idInt, _ := strconv.ParseInt(id, 10, 64)
-	if idInt%2 == 0 {
-		return D{B: int(idInt), A: "redis hit"}, nil
+func getDataFromRedis(ctx context.Context, collection string, key interface{}) (interface{}, error) {
+	id := key.(int)
+	if id%2 == 0 {
+		return D{B: id, A: "redis hit"}, nil
 	}
-	return nil, errors.New("not found")
+	return nil, errors.New(smartcache.E_not_found)
 }
 
 func setDataRedis(key, val interface{}) error {
 	log.Print(key, val)
 	return nil
 }
-func getDataFromMysql(cond interface{}) (interface{}, error) {
-	condI := cond.(string)
-	items := strings.Split(condI, ".")
-	id := items[len(items)-1]
-	idInt, _ := strconv.ParseInt(id, 10, 64)
-	log.Print(strconv.ParseInt(id, 16, 64))
-	if idInt%3 == 0 {
-		return D{B: int(idInt), A: "db hit"}, nil
+func getDataFromMysql(ctx context.Context, collection string, key interface{}) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
-	return nil, errors.New("not found")
+	id := key.(int)
+	if id%3 == 0 {
+		return D{B: id, A: "db hit"}, nil
+	}
+	return nil, errors.New(smartcache.E_not_found)
 }
 
 func main() {
@@ -63,14 +57,14 @@ func main() {
 	}
 	// simple reader
 	out2 := &D{}
-	cache.Select(context.TODO(), "key1").Get(2, nil, getDataFromRedis, getDataFromMysql).Exec(out2)
+	cache.Select(context.TODO(), "key1").GetWith(2, nil, getDataFromRedis, getDataFromMysql).Exec(out2)
 	log.Print(2, out2)
-	cache.Select(context.TODO(), "key1").Get(3, nil, getDataFromRedis, getDataFromMysql).Exec(out2)
+	cache.Select(context.TODO(), "key1").GetWith(3, nil, getDataFromRedis, getDataFromMysql).Exec(out2)
 	log.Print(3, out2)
-	cache.Select(context.TODO(), "key1").Get(6, nil, getDataFromRedis, getDataFromMysql).Exec(out2)
+	cache.Select(context.TODO(), "key1").GetWith(6, nil, getDataFromRedis, getDataFromMysql).Exec(out2)
 	log.Print(6, out2)
 
-	cache.Select(context.TODO(), "key1").Get(6, nil, getDataFromRedis, getDataFromMysql).Exec(out2)
+	cache.Select(context.TODO(), "key1").GetWith(6, nil, getDataFromRedis, getDataFromMysql).Exec(out2)
 	log.Print(6, out2)
 
 	// insert to set redis
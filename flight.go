@@ -0,0 +1,123 @@
+package smartcache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultLoadTimeout is max time a load shared by sessions run when CollectionConfig.LoadTimeout is not set
+const defaultLoadTimeout = time.Minute
+
+// flightCall is a load running or done for one key
+type flightCall struct {
+	done chan struct{}
+	val  interface{}
+	err  error
+}
+
+/**
+loadGroup make sure only one load run for a key at a time.
+Other callers of same key wait and share result of the first one.
+*/
+type loadGroup struct {
+	lock      sync.Mutex
+	calls     map[interface{}]*flightCall
+	coalesced uint64
+}
+
+func newLoadGroup() *loadGroup {
+	return &loadGroup{calls: make(map[interface{}]*flightCall)}
+}
+
+// do run fn for key, shared is true when result come from other caller
+func (g *loadGroup) do(key interface{}, fn func() (interface{}, error)) (val interface{}, err error, shared bool) {
+	call, first := g.join(key)
+	if !first {
+		<-call.done
+		return call.val, call.err, true
+	}
+	g.run(key, call, fn)
+	return call.val, call.err, false
+}
+
+// join return call running for key, first is true when caller create it and must run it
+func (g *loadGroup) join(key interface{}) (call *flightCall, first bool) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if call, has := g.calls[key]; has {
+		atomic.AddUint64(&g.coalesced, 1)
+		return call, false
+	}
+	call = &flightCall{done: make(chan struct{})}
+	g.calls[key] = call
+	return call, true
+}
+
+// run fn of call then wake up callers wait it
+func (g *loadGroup) run(key interface{}, call *flightCall, fn func() (interface{}, error)) {
+	defer func() {
+		g.lock.Lock()
+		delete(g.calls, key)
+		g.lock.Unlock()
+		close(call.done)
+	}()
+	call.val, call.err = fn()
+}
+
+// detachedContext keep values of parent but it's never done by parent
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+/**
+loadShared run load of key once for all sessions read it at the same time.
+Load run in background with ctx no caller can cancel, it keep values of first caller
+and it's done after LoadTimeout of collection or when collection closed.
+Each caller wait until load done or its own ctx done, then E_cancelled is returned only to it.
+*/
+func (c *Collection) loadShared(ctx context.Context, key interface{}, newLoad func(ctx context.Context) func() (interface{}, error)) (interface{}, error) {
+	call, first := c.flight.join(key)
+	if first {
+		started := c.goWorker(func() {
+			timeout := c.loadTimeout
+			if timeout <= 0 {
+				timeout = defaultLoadTimeout
+			}
+			timeoutCtx, cancelTimeout := context.WithTimeout(detachedContext{ctx}, timeout)
+			defer cancelTimeout()
+			loadCtx, cancel := c.stopContext(timeoutCtx)
+			defer cancel()
+			c.flight.run(key, call, newLoad(loadCtx))
+		})
+		if !started {
+			// collection closed, no background load, caller run it by own ctx
+			c.flight.run(key, call, newLoad(ctx))
+		}
+	}
+	select {
+	case <-call.done:
+		return call.val, call.err
+	case <-ctx.Done():
+		return nil, errors.New(E_cancelled)
+	}
+}
+
+// Coalesced is number of calls waited for other caller result
+func (g *loadGroup) Coalesced() uint64 {
+	return atomic.LoadUint64(&g.coalesced)
+}
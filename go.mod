@@ -1,5 +1,5 @@
 module github.com/teng231/smartcache
 
-go 1.17
+go 1.18
 
-require github.com/hashicorp/golang-lru v0.5.4 // indirect
+require github.com/hashicorp/golang-lru v0.5.4
@@ -1 +1,90 @@
 package smartcache
+
+import "sync"
+
+// HookReason is why a hook is fired
+type HookReason int
+
+const (
+	// ReasonSet value written by Upsert, Upserts
+	ReasonSet HookReason = iota
+	// ReasonDelete value removed by Delete
+	ReasonDelete
+	// ReasonEvict value removed because collection is full
+	ReasonEvict
+	// ReasonExpire value removed because it expired, by GC or read
+	ReasonExpire
+	// ReasonLoad value loaded by GetterFn
+	ReasonLoad
+)
+
+func (r HookReason) String() string {
+	switch r {
+	case ReasonSet:
+		return "set"
+	case ReasonDelete:
+		return "delete"
+	case ReasonEvict:
+		return "evict"
+	case ReasonExpire:
+		return "expire"
+	case ReasonLoad:
+		return "load"
+	}
+	return "unknown"
+}
+
+// HookFn is callback of a hook, it's called sync so should return fast
+type HookFn func(collectionKey string, key, value interface{}, reason HookReason)
+
+/**
+Hooks is registry of callbacks fired when item of collection changed.
+Engine has hooks for all collections, CollectionConfig has hooks for only that collection.
+*/
+type Hooks struct {
+	lock sync.RWMutex
+	fns  map[HookReason][]HookFn
+}
+
+func NewHooks() *Hooks {
+	return &Hooks{fns: make(map[HookReason][]HookFn)}
+}
+
+func (h *Hooks) On(reason HookReason, fn HookFn) *Hooks {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.fns[reason] = append(h.fns[reason], fn)
+	return h
+}
+
+func (h *Hooks) OnSet(fn HookFn) *Hooks {
+	return h.On(ReasonSet, fn)
+}
+
+func (h *Hooks) OnDelete(fn HookFn) *Hooks {
+	return h.On(ReasonDelete, fn)
+}
+
+func (h *Hooks) OnEvict(fn HookFn) *Hooks {
+	return h.On(ReasonEvict, fn)
+}
+
+func (h *Hooks) OnExpire(fn HookFn) *Hooks {
+	return h.On(ReasonExpire, fn)
+}
+
+func (h *Hooks) OnLoad(fn HookFn) *Hooks {
+	return h.On(ReasonLoad, fn)
+}
+
+func (h *Hooks) fire(reason HookReason, collectionKey string, key, value interface{}) {
+	if h == nil {
+		return
+	}
+	h.lock.RLock()
+	fns := h.fns[reason]
+	h.lock.RUnlock()
+	for _, fn := range fns {
+		fn(collectionKey, key, value, reason)
+	}
+}
@@ -0,0 +1,111 @@
+package smartcache
+
+import (
+	"context"
+	"log"
+	"sync"
+	"testing"
+	"time"
+)
+
+type hookRecord struct {
+	collectionKey string
+	key           interface{}
+	value         interface{}
+	reason        HookReason
+}
+
+type hookRecorder struct {
+	lock    sync.Mutex
+	records []hookRecord
+}
+
+func (r *hookRecorder) record(collectionKey string, key, value interface{}, reason HookReason) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.records = append(r.records, hookRecord{collectionKey, key, value, reason})
+}
+
+func (r *hookRecorder) count(reason HookReason) int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	n := 0
+	for _, rec := range r.records {
+		if rec.reason == reason {
+			n++
+		}
+	}
+	return n
+}
+
+func TestHooks(t *testing.T) {
+	colRec := &hookRecorder{}
+	engineRec := &hookRecorder{}
+	colHooks := NewHooks()
+	for _, reason := range []HookReason{ReasonSet, ReasonDelete, ReasonEvict, ReasonExpire, ReasonLoad} {
+		colHooks.On(reason, colRec.record)
+	}
+	e := Start(&CollectionConfig{Key: "hook", Capacity: 2, ExpireDuration: 10 * time.Second, Hooks: colHooks})
+	e.Hooks().OnEvict(engineRec.record).OnSet(engineRec.record)
+
+	s := e.Select(context.TODO(), "hook")
+	s.Upsert("k1", 1)
+	s.Upsert("k2", 2)
+	// k1 is evicted
+	s.Upsert("k3", 3)
+	if colRec.count(ReasonSet) != 3 || engineRec.count(ReasonSet) != 3 {
+		log.Print(colRec.records)
+		t.Fail()
+	}
+	if colRec.count(ReasonEvict) != 1 || engineRec.count(ReasonEvict) != 1 {
+		log.Print(colRec.records)
+		t.Fail()
+	}
+	evicted := engineRec.records[len(engineRec.records)-2]
+	if evicted.collectionKey != "hook" || evicted.key != "k1" || evicted.value != 1 {
+		log.Print(evicted)
+		t.Fail()
+	}
+
+	s.Delete("k2")
+	if colRec.count(ReasonDelete) != 1 || colRec.count(ReasonEvict) != 1 {
+		t.Fail()
+	}
+
+	var out int
+	e.Select(context.TODO(), "hook").Get("k4", nil, func(i interface{}) (interface{}, error) {
+		return 4, nil
+	}).Exec(&out)
+	if colRec.count(ReasonLoad) != 1 || colRec.count(ReasonSet) != 3 {
+		log.Print(colRec.records)
+		t.Fail()
+	}
+
+	e.Collection()["hook"].UpsertTTL(context.TODO(), "k5", 5, 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	e.Collection()["hook"].GC()
+	if colRec.count(ReasonExpire) != 1 {
+		log.Print(colRec.records)
+		t.Fail()
+	}
+}
+
+func TestHookCanUseCollection(t *testing.T) {
+	col, _ := CreateCollection(&CollectionConfig{Key: "hook", Capacity: 1, Hooks: NewHooks()})
+	evicted := make(chan interface{}, 1)
+	col.hooks.OnEvict(func(collectionKey string, key, value interface{}, reason HookReason) {
+		// no deadlock when hook read collection
+		col.Len()
+		evicted <- key
+	})
+	col.Upsert(context.TODO(), "k1", 1)
+	col.Upsert(context.TODO(), "k2", 2)
+	select {
+	case key := <-evicted:
+		if key != "k1" {
+			t.Fail()
+		}
+	case <-time.After(time.Second):
+		t.Fail()
+	}
+}
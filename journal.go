@@ -0,0 +1,351 @@
+package smartcache
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// SyncPolicy is when journal file is fsync to disk
+type SyncPolicy int
+
+const (
+	// SyncNever leave os flush file, fastest but can lose last writes when machine crash
+	SyncNever SyncPolicy = iota
+	// SyncEveryWrite fsync after each record
+	SyncEveryWrite
+	// SyncInterval fsync each JournalConfig.SyncInterval
+	SyncInterval
+)
+
+type JournalConfig struct {
+	Path         string
+	Sync         SyncPolicy
+	SyncInterval time.Duration
+	// CompactThreshold rewrite journal with only alive items when file bigger than this size in bytes
+	// and 2 times of size after last rewrite, 0 is never. Rewrite run in background
+	CompactThreshold int64
+}
+
+type journalOp uint8
+
+const (
+	journalSet journalOp = iota + 1
+	journalDelete
+)
+
+type journalRecord struct {
+	Op         journalOp
+	Collection string
+	Key        interface{}
+	Value      interface{}
+	Created    int64
+	Deadline   int64
+	Time       int64
+}
+
+// countWriter count bytes written to file
+type countWriter struct {
+	f    *os.File
+	size int64
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	n, err := w.f.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+/**
+journal is append only log of Upsert, Upserts and Delete of all collections.
+Start replay it on top of snapshot, then rewrite it with alive items and keep appending.
+Each process write one codec stream, so a record broken by crash only lose the tail.
+*/
+type journal struct {
+	lock     sync.Mutex
+	engine   *Engine
+	config   *JournalConfig
+	file     *countWriter
+	enc      Encoder
+	stopSync chan struct{}
+	doneSync chan struct{}
+	// baseSize is size of file after last rewrite
+	baseSize int64
+	// compactCh wake up compact loop, compactStop and compactDone stop it
+	compactCh   chan struct{}
+	compactStop chan struct{}
+	compactDone chan struct{}
+}
+
+// WithJournal enable mutation log, it's replayed after snapshot restored when Start
+func WithJournal(config *JournalConfig) Option {
+	return optionFunc(func(e *Engine) error {
+		e.journal = &journal{engine: e, config: config}
+		return nil
+	})
+}
+
+// open replay journal file then rewrite it and start appending
+func (j *journal) open() error {
+	if err := j.replay(); err != nil {
+		return err
+	}
+	j.engine.lock.RLock()
+	for _, col := range j.engine.mCollection {
+		col.journal = j
+	}
+	j.engine.lock.RUnlock()
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	if err := j.compactLocked(); err != nil {
+		return err
+	}
+	if j.config.Sync == SyncInterval && j.config.SyncInterval > 0 {
+		j.stopSync = make(chan struct{})
+		j.doneSync = make(chan struct{})
+		go j.syncLoop(j.config.SyncInterval)
+	}
+	if j.config.CompactThreshold > 0 {
+		j.compactCh = make(chan struct{}, 1)
+		j.compactStop = make(chan struct{})
+		j.compactDone = make(chan struct{})
+		go j.compactLoop()
+	}
+	return nil
+}
+
+func (j *journal) replay() error {
+	f, err := os.Open(j.config.Path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	dec := j.engine.codec.NewDecoder(f)
+	count := 0
+	for {
+		rec := &journalRecord{}
+		err := dec.Decode(rec)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// tail broken by crash, keep records before it
+			log.Print("journal: stop replay at record ", count, " ", err)
+			break
+		}
+		j.engine.lock.RLock()
+		col, has := j.engine.mCollection[rec.Collection]
+		j.engine.lock.RUnlock()
+		if !has {
+			continue
+		}
+		col.replay(rec)
+		count++
+	}
+	return nil
+}
+
+// replay apply a record of journal, hooks are not fired
+func (c *Collection) replay(rec *journalRecord) {
+	if rec.Op == journalDelete {
+		c.data.Remove(rec.Key)
+		return
+	}
+	colValue := &CollectionValue{Created: rec.Created, Value: rec.Value, Deadline: rec.Deadline}
+	now := time.Now().UnixNano()
+	if colValue.isExpired(now) {
+		c.data.Remove(rec.Key)
+		return
+	}
+	colValue.touch(now, c.settings().idleTimeout)
+	c.data.Add(rec.Key, colValue)
+}
+
+/**
+record append state of key in collection after a write.
+It check store again under journal lock: when key hold other value a newer write will record it,
+when key is gone a delete is recorded. So order of records follow order of writes in store.
+*/
+func (j *journal) record(c *Collection, key interface{}, written *CollectionValue) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	if j.enc == nil {
+		return
+	}
+	rec := &journalRecord{Collection: c.key, Key: key, Time: time.Now().UnixNano()}
+	value, has := c.data.Peek(key)
+	switch {
+	case !has:
+		rec.Op = journalDelete
+	case written != nil && value.(*CollectionValue) == written:
+		rec.Op = journalSet
+		rec.Value = written.Value
+		rec.Created = written.Created
+		rec.Deadline = written.Deadline
+	default:
+		return
+	}
+	if err := j.enc.Encode(rec); err != nil {
+		log.Print("journal: write fail ", err)
+		return
+	}
+	if j.config.Sync == SyncEveryWrite {
+		j.file.f.Sync()
+	}
+	if j.needCompact() {
+		select {
+		case j.compactCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// needCompact is true when file grown over CompactThreshold and 2 times of size after last rewrite,
+// so journal of live items bigger than threshold is not rewritten on each write
+func (j *journal) needCompact() bool {
+	if j.compactCh == nil {
+		return false
+	}
+	limit := j.config.CompactThreshold
+	if 2*j.baseSize > limit {
+		limit = 2 * j.baseSize
+	}
+	return j.file.size > limit
+}
+
+// compactLoop rewrite journal out of Upsert, Delete when record ask it
+func (j *journal) compactLoop() {
+	defer close(j.compactDone)
+	for {
+		select {
+		case <-j.compactCh:
+			j.lock.Lock()
+			if j.file != nil && j.needCompact() {
+				if err := j.compactLocked(); err != nil {
+					log.Print("journal: compact fail ", err)
+				}
+			}
+			j.lock.Unlock()
+		case <-j.compactStop:
+			return
+		}
+	}
+}
+
+// compact rewrite journal with only alive items
+func (j *journal) compact() error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	return j.compactLocked()
+}
+
+func (j *journal) compactLocked() error {
+	f, err := os.CreateTemp(filepath.Dir(j.config.Path), filepath.Base(j.config.Path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	file := &countWriter{f: f}
+	enc := j.engine.codec.NewEncoder(file)
+	j.engine.lock.RLock()
+	cols := make([]*Collection, 0, len(j.engine.mCollection))
+	for _, col := range j.engine.mCollection {
+		cols = append(cols, col)
+	}
+	j.engine.lock.RUnlock()
+	now := time.Now().UnixNano()
+	for _, col := range cols {
+		for _, item := range col.snapshot().Items {
+			rec := &journalRecord{
+				Op:         journalSet,
+				Collection: col.key,
+				Key:        item.Key,
+				Value:      item.Value,
+				Created:    item.Created,
+				Deadline:   item.Deadline,
+				Time:       now,
+			}
+			if err := enc.Encode(rec); err != nil {
+				f.Close()
+				os.Remove(f.Name())
+				return err
+			}
+		}
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), j.config.Path); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if j.file != nil {
+		j.file.f.Close()
+	}
+	j.file = file
+	j.enc = enc
+	j.baseSize = file.size
+	return nil
+}
+
+func (j *journal) syncLoop(interval time.Duration) {
+	defer close(j.doneSync)
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			j.lock.Lock()
+			if j.file != nil {
+				j.file.f.Sync()
+			}
+			j.lock.Unlock()
+		case <-j.stopSync:
+			return
+		}
+	}
+}
+
+// close sync and close journal file, records after close are dropped
+func (j *journal) close() error {
+	if j.stopSync != nil {
+		close(j.stopSync)
+		<-j.doneSync
+	}
+	if j.compactStop != nil {
+		close(j.compactStop)
+		<-j.compactDone
+	}
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	if j.file == nil {
+		return nil
+	}
+	// rewrite asked but compact loop stopped before it ran
+	if j.needCompact() {
+		if err := j.compactLocked(); err != nil {
+			log.Print("journal: compact fail ", err)
+		}
+	}
+	j.file.f.Sync()
+	err := j.file.f.Close()
+	j.file = nil
+	j.enc = nil
+	return err
+}
+
+// CompactJournal rewrite journal with only alive items now
+func (e *Engine) CompactJournal() error {
+	if e.journal == nil {
+		return nil
+	}
+	return e.journal.compact()
+}
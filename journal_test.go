@@ -0,0 +1,124 @@
+package smartcache
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestJournalReplay(t *testing.T) {
+	dir := t.TempDir()
+	journalPath := filepath.Join(dir, "cache.journal")
+	snapshotPath := filepath.Join(dir, "cache.snapshot")
+	start := func() *Engine {
+		return StartWithOptions(
+			&CollectionConfig{Key: "col", Capacity: 10, ExpireDuration: 10 * time.Second},
+			WithSnapshotRestore(snapshotPath),
+			WithJournal(&JournalConfig{Path: journalPath, Sync: SyncEveryWrite}),
+		)
+	}
+	e := start()
+	e.Select(context.TODO(), "col").Upsert("k1", "v1")
+	e.Select(context.TODO(), "col").Upsert("k2", "v2")
+	if err := e.SaveSnapshotFile(snapshotPath); err != nil {
+		log.Print(err)
+		t.Fail()
+	}
+	// writes after snapshot only in journal
+	e.Select(context.TODO(), "col").Upsert("k1", "v1-new")
+	e.Select(context.TODO(), "col").Delete("k2")
+	e.Collection()["col"].Upserts(context.TODO(), &CollectionKV{Key: "k3", Value: "v3"}, &CollectionKV{Key: "k4", Value: "v4", TTL: time.Millisecond})
+	time.Sleep(5 * time.Millisecond)
+	// crash, journal is not closed
+
+	e2 := start()
+	defer e2.Close(context.TODO())
+	col := e2.Collection()["col"]
+	if v, _ := col.Get(context.TODO(), "k1"); v != "v1-new" {
+		log.Print(v)
+		t.Fail()
+	}
+	if col.IsKeyExisted("k2") || col.IsKeyExisted("k4") {
+		log.Print("k2 deleted, k4 expired")
+		t.Fail()
+	}
+	if v, _ := col.Get(context.TODO(), "k3"); v != "v3" {
+		t.Fail()
+	}
+}
+
+func TestJournalCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.journal")
+	e := StartWithOptions(
+		&CollectionConfig{Key: "col", Capacity: 10},
+		WithJournal(&JournalConfig{Path: path, CompactThreshold: 4096}),
+	)
+	for i := 0; i < 1000; i++ {
+		e.Select(context.TODO(), "col").Upsert(i%5, i)
+	}
+	if err := e.Close(context.TODO()); err != nil {
+		t.Fail()
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.Size() > 4096*2 {
+		log.Print(info.Size(), err)
+		t.Fail()
+	}
+
+	e2 := StartWithOptions(&CollectionConfig{Key: "col", Capacity: 10}, WithJournal(&JournalConfig{Path: path}))
+	defer e2.Close(context.TODO())
+	if e2.Collection()["col"].Len() != 5 {
+		t.Fail()
+	}
+	if v, _ := e2.Collection()["col"].Get(context.TODO(), 4); v != 999 {
+		log.Print(v)
+		t.Fail()
+	}
+}
+
+func TestJournalBrokenTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.journal")
+	e := StartWithOptions(&CollectionConfig{Key: "col", Capacity: 10}, WithJournal(&JournalConfig{Path: path}))
+	e.Select(context.TODO(), "col").Upsert("k1", "v1")
+	e.Select(context.TODO(), "col").Upsert("k2", "v2")
+	e.Close(context.TODO())
+	info, _ := os.Stat(path)
+	os.Truncate(path, info.Size()-3)
+
+	e2 := StartWithOptions(&CollectionConfig{Key: "col", Capacity: 10}, WithJournal(&JournalConfig{Path: path}))
+	defer e2.Close(context.TODO())
+	if !e2.Collection()["col"].IsKeyExisted("k1") {
+		t.Fail()
+	}
+}
+
+func TestJournalCompactGrowth(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.journal")
+	e := StartWithOptions(
+		&CollectionConfig{Key: "col", Capacity: 100},
+		WithJournal(&JournalConfig{Path: path, CompactThreshold: 200}),
+	)
+	defer e.Close(context.TODO())
+	for i := 0; i < 50; i++ {
+		e.Select(context.TODO(), "col").Upsert(i, i)
+	}
+	e.CompactJournal()
+	base := e.journal.baseSize
+	if base <= 200 {
+		log.Print(base)
+		t.Fail()
+	}
+	// live data bigger than threshold, a write don't rewrite journal
+	e.Select(context.TODO(), "col").Upsert(1, 100)
+	time.Sleep(20 * time.Millisecond)
+	e.journal.lock.Lock()
+	size, baseAfter := e.journal.file.size, e.journal.baseSize
+	e.journal.lock.Unlock()
+	if baseAfter != base || size <= base {
+		log.Print(base, baseAfter, size)
+		t.Fail()
+	}
+}
@@ -0,0 +1,155 @@
+package smartcache
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// KeyBuilder build key passed to getters, setters from key of collection and the original key
+type KeyBuilder func(collection string, key interface{}) interface{}
+
+// DefaultKeyBuilder build "collection.key", key is encoded by EncodeKey
+func DefaultKeyBuilder(collection string, key interface{}) interface{} {
+	return collection + "." + EncodeKey(key)
+}
+
+// NewKeyBuilder build prefix + collection + sep + EncodeKey(key), like NewKeyBuilder("svc:v2:", ":") build "svc:v2:users:10"
+func NewKeyBuilder(prefix, sep string) KeyBuilder {
+	return func(collection string, key interface{}) interface{} {
+		return prefix + collection + sep + EncodeKey(key)
+	}
+}
+
+// WithKeyBuilder set key builder of collections don't have CollectionConfig.KeyBuilder
+func WithKeyBuilder(kb KeyBuilder) Option {
+	return optionFunc(func(e *Engine) error {
+		e.keyBuilder = kb
+		return nil
+	})
+}
+
+/**
+EncodeKey encode key to string stable between processes.
+Strings, numbers and fmt.Stringer are written as is, same as %v.
+Structs, maps, slices and pointers are written by their content, not by address:
+struct is {Field:value,...} in field order, map is sorted by encoded key, strings inside are quoted.
+*/
+func EncodeKey(key interface{}) string {
+	switch k := key.(type) {
+	case string:
+		return k
+	case int:
+		return strconv.Itoa(k)
+	case int64:
+		return strconv.FormatInt(k, 10)
+	case uint64:
+		return strconv.FormatUint(k, 10)
+	}
+	v := reflect.ValueOf(key)
+	if k, ok := key.(fmt.Stringer); ok && !(v.Kind() == reflect.Ptr && v.IsNil()) {
+		return k.String()
+	}
+	switch v.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array, reflect.Ptr, reflect.Interface:
+		b := &strings.Builder{}
+		encodeValue(b, v)
+		return b.String()
+	}
+	b := &strings.Builder{}
+	encodeScalar(b, v, false)
+	return b.String()
+}
+
+func encodeValue(b *strings.Builder, v reflect.Value) {
+	if v.IsValid() && v.CanInterface() {
+		if s, ok := v.Interface().(fmt.Stringer); ok && !(v.Kind() == reflect.Ptr && v.IsNil()) {
+			b.WriteString(strconv.Quote(s.String()))
+			return
+		}
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			b.WriteString("nil")
+			return
+		}
+		encodeValue(b, v.Elem())
+	case reflect.Struct:
+		t := v.Type()
+		b.WriteByte('{')
+		for i := 0; i < v.NumField(); i++ {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(t.Field(i).Name)
+			b.WriteByte(':')
+			encodeValue(b, v.Field(i))
+		}
+		b.WriteByte('}')
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			b.WriteString("nil")
+			return
+		}
+		b.WriteByte('[')
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			encodeValue(b, v.Index(i))
+		}
+		b.WriteByte(']')
+	case reflect.Map:
+		if v.IsNil() {
+			b.WriteString("nil")
+			return
+		}
+		entries := make([]string, 0, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			e := &strings.Builder{}
+			encodeValue(e, iter.Key())
+			e.WriteByte(':')
+			encodeValue(e, iter.Value())
+			entries = append(entries, e.String())
+		}
+		sort.Strings(entries)
+		b.WriteString("map[")
+		b.WriteString(strings.Join(entries, ","))
+		b.WriteByte(']')
+	default:
+		encodeScalar(b, v, true)
+	}
+}
+
+// encodeScalar write basic value, string is quoted when it's inside composite key
+func encodeScalar(b *strings.Builder, v reflect.Value, quote bool) {
+	switch v.Kind() {
+	case reflect.String:
+		if quote {
+			b.WriteString(strconv.Quote(v.String()))
+			return
+		}
+		b.WriteString(v.String())
+	case reflect.Bool:
+		b.WriteString(strconv.FormatBool(v.Bool()))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		b.WriteString(strconv.FormatInt(v.Int(), 10))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		b.WriteString(strconv.FormatUint(v.Uint(), 10))
+	case reflect.Float32:
+		b.WriteString(strconv.FormatFloat(v.Float(), 'g', -1, 32))
+	case reflect.Float64:
+		b.WriteString(strconv.FormatFloat(v.Float(), 'g', -1, 64))
+	case reflect.Complex64, reflect.Complex128:
+		b.WriteString(strconv.FormatComplex(v.Complex(), 'g', -1, 128))
+	case reflect.Invalid:
+		b.WriteString("nil")
+	default:
+		// chan, func are not stable, type is the best can be written
+		b.WriteString(v.Type().String())
+	}
+}
@@ -0,0 +1,139 @@
+package smartcache
+
+import (
+	"context"
+	"log"
+	"testing"
+	"time"
+)
+
+type userKey struct {
+	Tenant string
+	ID     int
+	tags   []string
+}
+
+type orderKey struct {
+	Tenant string
+	ID     int
+}
+
+type namedKey struct {
+	Name string
+}
+
+func (k *namedKey) String() string {
+	return "name-" + k.Name
+}
+
+func TestEncodeKey(t *testing.T) {
+	cases := []struct {
+		key  interface{}
+		want string
+	}{
+		{"abc", "abc"},
+		{10, "10"},
+		{int8(-3), "-3"},
+		{1.5, "1.5"},
+		{true, "true"},
+		{nil, "nil"},
+		{time.Second, "1s"},
+		{userKey{Tenant: "a", ID: 1}, `{Tenant:"a",ID:1,tags:nil}`},
+		{&userKey{Tenant: "a", ID: 1, tags: []string{"x", "y"}}, `{Tenant:"a",ID:1,tags:["x","y"]}`},
+		{[2]int{1, 2}, "[1,2]"},
+		{[]interface{}{"a", 1, nil}, `["a",1,nil]`},
+		{map[string]int{"b": 2, "a": 1, "c": 3}, `map["a":1,"b":2,"c":3]`},
+		{struct{ D time.Duration }{time.Minute}, `{D:"1m0s"}`},
+		{&namedKey{Name: "a"}, "name-a"},
+		{(*namedKey)(nil), "nil"},
+		{[]*namedKey{nil}, "[nil]"},
+	}
+	for _, c := range cases {
+		if got := EncodeKey(c.key); got != c.want {
+			log.Printf("EncodeKey(%#v) = %s, want %s", c.key, got, c.want)
+			t.Fail()
+		}
+	}
+	// map order must not change encoding
+	for i := 0; i < 20; i++ {
+		m := map[[2]string]bool{{"a", "1"}: true, {"b", "2"}: false, {"c", "3"}: true}
+		if EncodeKey(m) != `map[["a","1"]:true,["b","2"]:false,["c","3"]:true]` {
+			log.Print(EncodeKey(m))
+			t.Fail()
+			break
+		}
+	}
+	// string inside composite is quoted so parts can't be mixed
+	if EncodeKey([]string{"a,b"}) == EncodeKey([]string{"a", "b"}) {
+		t.Fail()
+	}
+}
+
+func TestKeyBuilderOfCollection(t *testing.T) {
+	var got interface{}
+	getter := func(key interface{}) (interface{}, error) {
+		got = key
+		return "v", nil
+	}
+	engine := StartWithOptions(
+		WithKeyBuilder(NewKeyBuilder("svc:v2:", ":")),
+		&CollectionConfig{Key: "users", Capacity: 10},
+		&CollectionConfig{Key: "typed", Capacity: 10, KeyBuilder: func(collection string, key interface{}) interface{} {
+			return key
+		}},
+	)
+	defer engine.Close(context.Background())
+
+	var out string
+	if _, err := engine.Select(context.Background(), "users").Get(10, nil, getter).Exec(&out); err != nil {
+		log.Print(err)
+		t.Fail()
+	}
+	if got != "svc:v2:users:10" {
+		log.Print(got)
+		t.Fail()
+	}
+	if _, err := engine.Select(context.Background(), "users").Get(orderKey{Tenant: "a", ID: 2}, nil, getter).Exec(&out); err != nil {
+		log.Print(err)
+		t.Fail()
+	}
+	if got != `svc:v2:users:{Tenant:"a",ID:2}` {
+		log.Print(got)
+		t.Fail()
+	}
+
+	// loader of collection with own builder receive typed key
+	key := orderKey{Tenant: "b", ID: 3}
+	if _, err := engine.Select(context.Background(), "typed").Get(key, nil, getter).Exec(&out); err != nil {
+		log.Print(err)
+		t.Fail()
+	}
+	if k, ok := got.(orderKey); !ok || k.ID != 3 {
+		log.Print(got)
+		t.Fail()
+	}
+
+	var setKey interface{}
+	setter := func(key interface{}, value interface{}) error {
+		setKey = key
+		return nil
+	}
+	if err := engine.Select(context.Background(), "users").Upsert(5, "x", setter); err != nil {
+		log.Print(err)
+		t.Fail()
+	}
+	if setKey != "svc:v2:users:5" {
+		log.Print(setKey)
+		t.Fail()
+	}
+}
+
+func TestDefaultKeyBuilder(t *testing.T) {
+	engine := Start(&CollectionConfig{Key: "col", Capacity: 10})
+	defer engine.Close(context.Background())
+	s := engine.Select(context.Background(), "col")
+	if s.KeyBulder(1) != "col.1" || s.KeyBulder("a") != "col.a" {
+		log.Print(s.KeyBulder(1))
+		t.Fail()
+	}
+}
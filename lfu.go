@@ -0,0 +1,186 @@
+package smartcache
+
+import (
+	"container/list"
+	"sort"
+
+	"github.com/hashicorp/golang-lru/simplelru"
+)
+
+type lfuEntry struct {
+	key   interface{}
+	value interface{}
+	freq  int
+	elem  *list.Element
+}
+
+/**
+lfu evict item used least times, Add and Get count as a use.
+Items of same frequency are in a list newest at front, so oldest of them is evicted first.
+*/
+type lfu struct {
+	size    int
+	items   map[interface{}]*lfuEntry
+	freqs   map[int]*list.List
+	minFreq int
+	onEvict simplelru.EvictCallback
+}
+
+func newLFU(size int, onEvict simplelru.EvictCallback) *lfu {
+	return &lfu{
+		size:    size,
+		items:   make(map[interface{}]*lfuEntry),
+		freqs:   make(map[int]*list.List),
+		onEvict: onEvict,
+	}
+}
+
+func (c *lfu) push(e *lfuEntry) {
+	l, has := c.freqs[e.freq]
+	if !has {
+		l = list.New()
+		c.freqs[e.freq] = l
+	}
+	e.elem = l.PushFront(e)
+}
+
+func (c *lfu) unlink(e *lfuEntry) {
+	l := c.freqs[e.freq]
+	l.Remove(e.elem)
+	if l.Len() == 0 {
+		delete(c.freqs, e.freq)
+	}
+}
+
+func (c *lfu) touch(e *lfuEntry) {
+	c.unlink(e)
+	if e.freq == c.minFreq && c.freqs[e.freq] == nil {
+		c.minFreq++
+	}
+	e.freq++
+	c.push(e)
+}
+
+// lowest return list of least frequency, minFreq may be behind after Remove
+func (c *lfu) lowest() *list.List {
+	if l, has := c.freqs[c.minFreq]; has {
+		return l
+	}
+	c.minFreq = 0
+	for freq := range c.freqs {
+		if c.minFreq == 0 || freq < c.minFreq {
+			c.minFreq = freq
+		}
+	}
+	return c.freqs[c.minFreq]
+}
+
+func (c *lfu) evict() {
+	c.RemoveOldest()
+}
+
+// RemoveOldest evict oldest item of least frequency
+func (c *lfu) RemoveOldest() (interface{}, interface{}, bool) {
+	l := c.lowest()
+	if l == nil {
+		return nil, nil, false
+	}
+	e := l.Back().Value.(*lfuEntry)
+	c.unlink(e)
+	delete(c.items, e.key)
+	if c.onEvict != nil {
+		c.onEvict(e.key, e.value)
+	}
+	return e.key, e.value, true
+}
+
+func (c *lfu) Add(key, value interface{}) bool {
+	if e, has := c.items[key]; has {
+		e.value = value
+		c.touch(e)
+		return false
+	}
+	evicted := false
+	if len(c.items) >= c.size {
+		c.evict()
+		evicted = true
+	}
+	e := &lfuEntry{key: key, value: value, freq: 1}
+	c.push(e)
+	c.items[key] = e
+	c.minFreq = 1
+	return evicted
+}
+
+func (c *lfu) Get(key interface{}) (interface{}, bool) {
+	e, has := c.items[key]
+	if !has {
+		return nil, false
+	}
+	c.touch(e)
+	return e.value, true
+}
+
+func (c *lfu) Peek(key interface{}) (interface{}, bool) {
+	e, has := c.items[key]
+	if !has {
+		return nil, false
+	}
+	return e.value, true
+}
+
+func (c *lfu) Contains(key interface{}) bool {
+	_, has := c.items[key]
+	return has
+}
+
+func (c *lfu) Remove(key interface{}) bool {
+	e, has := c.items[key]
+	if !has {
+		return false
+	}
+	c.unlink(e)
+	delete(c.items, key)
+	return true
+}
+
+// Keys return keys from least to most frequent, oldest first for same frequency
+func (c *lfu) Keys() []interface{} {
+	freqs := make([]int, 0, len(c.freqs))
+	for freq := range c.freqs {
+		freqs = append(freqs, freq)
+	}
+	sort.Ints(freqs)
+	keys := make([]interface{}, 0, len(c.items))
+	for _, freq := range freqs {
+		for el := c.freqs[freq].Back(); el != nil; el = el.Prev() {
+			keys = append(keys, el.Value.(*lfuEntry).key)
+		}
+	}
+	return keys
+}
+
+func (c *lfu) Len() int {
+	return len(c.items)
+}
+
+func (c *lfu) Resize(size int) int {
+	evicted := 0
+	for len(c.items) > size {
+		c.evict()
+		evicted++
+	}
+	c.size = size
+	return evicted
+}
+
+func (c *lfu) Purge() {
+	for key, e := range c.items {
+		if c.onEvict != nil {
+			c.onEvict(key, e.value)
+		}
+	}
+	c.items = make(map[interface{}]*lfuEntry)
+	c.freqs = make(map[int]*list.List)
+	c.minFreq = 0
+}
@@ -0,0 +1,113 @@
+package smartcache
+
+import (
+	"errors"
+	"time"
+)
+
+// collectionSettings can be changed while collection is used, it's replaced as a whole
+type collectionSettings struct {
+	capacity       int
+	expireDuration time.Duration
+	idleTimeout    time.Duration
+	negativeTTL    time.Duration
+}
+
+func (c *Collection) settings() collectionSettings {
+	return c.tuning.Load().(collectionSettings)
+}
+
+// setGCInterval stop running GC loop and start new one when interval > 0
+func (c *Collection) setGCInterval(interval time.Duration) {
+	c.tuneLock.Lock()
+	defer c.tuneLock.Unlock()
+	if c.gcStop != nil {
+		close(c.gcStop)
+		c.gcStop = nil
+	}
+	select {
+	case <-c.stop:
+		return
+	default:
+	}
+	if interval > 0 {
+		c.gcStop = make(chan struct{})
+		c.startGC(interval, c.gcStop)
+	}
+}
+
+// resize change capacity of collection, return number of items evicted
+func (c *Collection) resize(capacity int) int {
+	c.tuneLock.Lock()
+	settings := c.settings()
+	settings.capacity = capacity
+	c.tuning.Store(settings)
+	c.tuneLock.Unlock()
+	return c.data.Resize(capacity)
+}
+
+// RemoveCollection remove collection from engine and stop its workers, writes wait in write behind are flushed.
+// Sessions selected before still work on data of it
+func (e *Engine) RemoveCollection(collectionKey string) error {
+	e.lock.Lock()
+	col, has := e.mCollection[collectionKey]
+	if !has {
+		e.lock.Unlock()
+		return errors.New(E_not_found_any_collection_key)
+	}
+	delete(e.mCollection, collectionKey)
+	delete(e.mConfigCollection, collectionKey)
+	e.lock.Unlock()
+	col.Close()
+	return nil
+}
+
+// ResizeCollection change capacity of collection, items over it are evicted. Return number of items evicted.
+// Evict hooks run out of engine lock, so they can use engine
+func (e *Engine) ResizeCollection(collectionKey string, capacity int) (int, error) {
+	if capacity <= 0 {
+		return 0, errors.New(E_invalid_capacity)
+	}
+	e.lock.Lock()
+	col, has := e.mCollection[collectionKey]
+	if !has {
+		e.lock.Unlock()
+		return 0, errors.New(E_not_found_any_collection_key)
+	}
+	cf := *e.mConfigCollection[collectionKey]
+	cf.Capacity = capacity
+	e.mConfigCollection[collectionKey] = &cf
+	e.lock.Unlock()
+	return col.resize(capacity), nil
+}
+
+/**
+UpdateCollectionConfig apply ExpireDuration, IdleTimeout, NegativeTTL and GCInterval of cf
+to collection has same Key, other fields are ignored.
+New ttl is used by next writes, items already in collection keep their deadline.
+*/
+func (e *Engine) UpdateCollectionConfig(cf *CollectionConfig) error {
+	e.lock.Lock()
+	col, has := e.mCollection[cf.Key]
+	if !has {
+		e.lock.Unlock()
+		return errors.New(E_not_found_any_collection_key)
+	}
+	next := *e.mConfigCollection[cf.Key]
+	next.ExpireDuration = cf.ExpireDuration
+	next.IdleTimeout = cf.IdleTimeout
+	next.NegativeTTL = cf.NegativeTTL
+	next.GCInterval = cf.GCInterval
+	e.mConfigCollection[cf.Key] = &next
+	e.lock.Unlock()
+
+	col.tuneLock.Lock()
+	settings := col.settings()
+	settings.expireDuration = cf.ExpireDuration
+	settings.idleTimeout = cf.IdleTimeout
+	settings.negativeTTL = cf.NegativeTTL
+	col.tuning.Store(settings)
+	col.tuneLock.Unlock()
+	col.setGCInterval(cf.GCInterval)
+	return nil
+}
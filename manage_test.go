@@ -0,0 +1,125 @@
+package smartcache
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEngineRemoveCollection(t *testing.T) {
+	e := Start(&CollectionConfig{Key: "a", Capacity: 10, GCInterval: time.Millisecond}, &CollectionConfig{Key: "b", Capacity: 10})
+	if err := e.RemoveCollection("a"); err != nil {
+		t.Fail()
+	}
+	var out int
+	if _, err := e.Select(context.TODO(), "a").Get("k", nil).Exec(&out); err == nil || err.Error() != E_not_found_any_collection_key {
+		t.Fail()
+	}
+	if err := e.RemoveCollection("a"); err == nil {
+		t.Fail()
+	}
+	if len(e.Collection()) != 1 || len(e.CollectionConfig()) != 1 {
+		t.Fail()
+	}
+}
+
+func TestEngineResizeCollection(t *testing.T) {
+	e := Start(&CollectionConfig{Key: "r", Capacity: 10})
+	for i := 0; i < 10; i++ {
+		e.Select(context.TODO(), "r").Upsert(i, i)
+	}
+	evicted, err := e.ResizeCollection("r", 4)
+	col := e.Collection()["r"]
+	if err != nil || evicted != 6 || col.Len() != 4 || col.Stats().Capacity != 4 || e.CollectionConfig()["r"].Capacity != 4 {
+		log.Print(evicted, err, col.Len())
+		t.Fail()
+	}
+	if _, err := e.ResizeCollection("r", 0); err == nil {
+		t.Fail()
+	}
+	if _, err := e.ResizeCollection("x", 1); err == nil {
+		t.Fail()
+	}
+}
+
+func TestEngineResizeHookSelect(t *testing.T) {
+	var e *Engine
+	var selected int32
+	hooks := NewHooks().OnEvict(func(collectionKey string, key, value interface{}, reason HookReason) {
+		// hook use engine while resize run
+		e.Select(context.TODO(), "other").Upsert(key, value)
+		atomic.AddInt32(&selected, 1)
+	})
+	e = Start(&CollectionConfig{Key: "rh", Capacity: 10, Hooks: hooks}, &CollectionConfig{Key: "other", Capacity: 10})
+	defer e.Close(context.TODO())
+	for i := 0; i < 10; i++ {
+		e.Select(context.TODO(), "rh").Upsert(i, i)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		e.ResizeCollection("rh", 5)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		log.Print("resize deadlock")
+		t.FailNow()
+	}
+	if atomic.LoadInt32(&selected) != 5 || e.Collection()["other"].Len() != 5 {
+		log.Print(selected)
+		t.Fail()
+	}
+}
+
+func TestEngineUpdateCollectionConfig(t *testing.T) {
+	e := Start(&CollectionConfig{Key: "u", Capacity: 10, ExpireDuration: time.Hour})
+	col := e.Collection()["u"]
+	col.Upsert(context.TODO(), "old", 1)
+	if err := e.UpdateCollectionConfig(&CollectionConfig{Key: "u", ExpireDuration: 10 * time.Millisecond, GCInterval: 10 * time.Millisecond}); err != nil {
+		t.Fail()
+	}
+	col.Upsert(context.TODO(), "new", 1)
+	time.Sleep(50 * time.Millisecond)
+	// gc remove new item, old item keep its deadline
+	if !col.data.Contains("old") || col.data.Contains("new") {
+		t.Fail()
+	}
+	if e.CollectionConfig()["u"].ExpireDuration != 10*time.Millisecond || e.CollectionConfig()["u"].Capacity != 10 {
+		t.Fail()
+	}
+	// gc stopped
+	e.UpdateCollectionConfig(&CollectionConfig{Key: "u", ExpireDuration: 10 * time.Millisecond})
+	col.Upsert(context.TODO(), "new", 1)
+	time.Sleep(50 * time.Millisecond)
+	if !col.data.Contains("new") {
+		t.Fail()
+	}
+}
+
+func TestEngineManageConcurrent(t *testing.T) {
+	e := Start(&CollectionConfig{Key: "c", Capacity: 100, ExpireDuration: time.Second})
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				var out int
+				e.Select(context.TODO(), "c").Upsert(j, j)
+				e.Select(context.TODO(), "c").Get(j, nil).Exec(&out)
+			}
+		}(i)
+	}
+	for j := 0; j < 20; j++ {
+		e.ResizeCollection("c", 50+j)
+		e.UpdateCollectionConfig(&CollectionConfig{Key: "c", ExpireDuration: time.Duration(j+1) * time.Second, GCInterval: time.Millisecond})
+		e.AddCollection(&CollectionConfig{Key: "tmp", Capacity: 10})
+		e.RemoveCollection("tmp")
+	}
+	wg.Wait()
+	e.Close(context.TODO())
+}
@@ -0,0 +1,104 @@
+package smartcache
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+type metricSample struct {
+	name  string
+	help  string
+	typ   string
+	value func(c *Collection) float64
+}
+
+var collectionMetrics = []metricSample{
+	{"smartcache_collection_size", "Number of items in collection.", "gauge", func(c *Collection) float64 { return float64(c.Len()) }},
+	{"smartcache_collection_capacity", "Max number of items in collection.", "gauge", func(c *Collection) float64 { return float64(c.settings().capacity) }},
+	{"smartcache_collection_bytes", "Bytes of items in collection counted by Sizer, 0 when MaxBytes is not set.", "gauge", func(c *Collection) float64 { return float64(c.data.Bytes()) }},
+	{"smartcache_collection_max_bytes", "Max bytes of items in collection, 0 is no limit.", "gauge", func(c *Collection) float64 { return float64(c.maxBytes) }},
+	{"smartcache_hits_total", "Number of reads found key.", "counter", func(c *Collection) float64 { return float64(atomic.LoadUint64(&c.stats.hits)) }},
+	{"smartcache_misses_total", "Number of reads not found key.", "counter", func(c *Collection) float64 { return float64(atomic.LoadUint64(&c.stats.misses)) }},
+	{"smartcache_stale_hits_total", "Number of reads return stale value.", "counter", func(c *Collection) float64 { return float64(atomic.LoadUint64(&c.stats.staleHits)) }},
+	{"smartcache_negative_hits_total", "Number of reads found key remembered as not found.", "counter", func(c *Collection) float64 { return float64(atomic.LoadUint64(&c.stats.negativeHits)) }},
+	{"smartcache_loads_total", "Number of values loaded by getters.", "counter", func(c *Collection) float64 { return float64(atomic.LoadUint64(&c.stats.loads)) }},
+	{"smartcache_load_failures_total", "Number of getter calls return error.", "counter", func(c *Collection) float64 { return float64(atomic.LoadUint64(&c.stats.loadFailures)) }},
+	{"smartcache_setter_failures_total", "Number of setter calls return error.", "counter", func(c *Collection) float64 { return float64(atomic.LoadUint64(&c.stats.setterFailures)) }},
+	{"smartcache_expirations_total", "Number of items removed because expired.", "counter", func(c *Collection) float64 { return float64(atomic.LoadUint64(&c.stats.expirations)) }},
+	{"smartcache_evictions_total", "Number of items removed because collection is full.", "counter", func(c *Collection) float64 { return float64(atomic.LoadUint64(&c.stats.evictions)) }},
+	{"smartcache_refreshes_total", "Number of items reloaded before expired.", "counter", func(c *Collection) float64 { return float64(atomic.LoadUint64(&c.stats.refreshes)) }},
+	{"smartcache_load_retries_total", "Number of getter calls retried.", "counter", func(c *Collection) float64 { return float64(atomic.LoadUint64(&c.stats.loadRetries)) }},
+	{"smartcache_setter_retries_total", "Number of setter calls retried.", "counter", func(c *Collection) float64 { return float64(atomic.LoadUint64(&c.stats.setterRetries)) }},
+	{"smartcache_write_queued", "Number of writes wait to flush by write behind.", "gauge", func(c *Collection) float64 { return float64(c.writeQueued()) }},
+	{"smartcache_write_drops_total", "Number of writes dropped because write behind queue is full.", "counter", func(c *Collection) float64 { return float64(atomic.LoadUint64(&c.stats.writeDrops)) }},
+	{"smartcache_write_failures_total", "Number of items write behind failed to write.", "counter", func(c *Collection) float64 { return float64(atomic.LoadUint64(&c.stats.writeFailures)) }},
+	{"smartcache_coalesced_total", "Number of loads waited for same key load of other caller.", "counter", func(c *Collection) float64 { return float64(c.Coalesced()) }},
+}
+
+/**
+MetricsHandler return http handler write metrics of all collections
+in prometheus text format, so it can be scraped like other /metrics.
+*/
+func (e *Engine) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf := &bytes.Buffer{}
+		e.writeMetrics(buf)
+		w.Header().Set("Content-Type", metricsContentType)
+		w.Write(buf.Bytes())
+	})
+}
+
+func (e *Engine) writeMetrics(buf *bytes.Buffer) {
+	e.lock.RLock()
+	keys := make([]string, 0, len(e.mCollection))
+	cols := make(map[string]*Collection, len(e.mCollection))
+	for key, col := range e.mCollection {
+		keys = append(keys, key)
+		cols[key] = col
+	}
+	e.lock.RUnlock()
+	sort.Strings(keys)
+
+	for _, m := range collectionMetrics {
+		fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.typ)
+		for _, key := range keys {
+			fmt.Fprintf(buf, "%s{collection=\"%s\"} %s\n", m.name, escapeLabel(key), formatFloat(m.value(cols[key])))
+		}
+	}
+
+	name := "smartcache_load_duration_seconds"
+	fmt.Fprintf(buf, "# HELP %s Latency of getter calls.\n# TYPE %s histogram\n", name, name)
+	for _, key := range keys {
+		stats := cols[key].stats
+		label := escapeLabel(key)
+		var cumulative uint64
+		for i, bound := range loadBucketBounds {
+			cumulative += atomic.LoadUint64(&stats.loadBuckets[i])
+			fmt.Fprintf(buf, "%s_bucket{collection=\"%s\",le=\"%s\"} %d\n", name, label, formatFloat(bound.Seconds()), cumulative)
+		}
+		count := atomic.LoadUint64(&stats.loads) + atomic.LoadUint64(&stats.loadFailures)
+		if count < cumulative {
+			count = cumulative
+		}
+		fmt.Fprintf(buf, "%s_bucket{collection=\"%s\",le=\"+Inf\"} %d\n", name, label, count)
+		fmt.Fprintf(buf, "%s_sum{collection=\"%s\"} %s\n", name, label, formatFloat(float64(atomic.LoadUint64(&stats.loadNanos))/1e9))
+		fmt.Fprintf(buf, "%s_count{collection=\"%s\"} %d\n", name, label, count)
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,49 @@
+package smartcache
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	e := Start(
+		&CollectionConfig{Key: "m1", Capacity: 10, ExpireDuration: 10 * time.Second},
+		&CollectionConfig{Key: "m\"2", Capacity: 20},
+	)
+	e.Select(context.TODO(), "m1").Upsert("k1", 1)
+	var out int
+	e.Select(context.TODO(), "m1").Get("k1", nil).Exec(&out)
+	e.Select(context.TODO(), "m1").Get("k2", nil, func(i interface{}) (interface{}, error) {
+		return 2, nil
+	}).Exec(&out)
+
+	rec := httptest.NewRecorder()
+	e.MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+	text := string(body)
+	log.Print(text)
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Fail()
+	}
+	for _, line := range []string{
+		`smartcache_collection_size{collection="m1"} 2`,
+		`smartcache_collection_capacity{collection="m\"2"} 20`,
+		`smartcache_hits_total{collection="m1"} 1`,
+		`smartcache_misses_total{collection="m1"} 1`,
+		`smartcache_loads_total{collection="m1"} 1`,
+		`smartcache_load_duration_seconds_bucket{collection="m1",le="0.001"} 1`,
+		`smartcache_load_duration_seconds_bucket{collection="m1",le="+Inf"} 1`,
+		`smartcache_load_duration_seconds_count{collection="m1"} 1`,
+		`# TYPE smartcache_evictions_total counter`,
+	} {
+		if !strings.Contains(text, line+"\n") {
+			log.Print("missing ", line)
+			t.Fail()
+		}
+	}
+}
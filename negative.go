@@ -0,0 +1,29 @@
+package smartcache
+
+import "time"
+
+// negativeEntry is value of a key no getter can find, saved by NegativeTTL
+type negativeEntry struct{}
+
+func (v *CollectionValue) isNegative() bool {
+	_, ok := v.Value.(negativeEntry)
+	return ok
+}
+
+// saveNegative remember key is not found in NegativeTTL, Upsert of key drop it.
+// Value saved by other caller is kept, only missing, dead or negative value is replaced
+func (c *Collection) saveNegative(key interface{}) {
+	negativeTTL := c.settings().negativeTTL
+	if negativeTTL <= 0 {
+		return
+	}
+	now := time.Now()
+	c.data.AddIf(key, &CollectionValue{
+		Created:  now.Unix(),
+		Value:    negativeEntry{},
+		Deadline: now.Add(negativeTTL).UnixNano(),
+	}, func(old interface{}) bool {
+		colValue := old.(*CollectionValue)
+		return colValue.isNegative() || c.isDead(colValue, now.UnixNano())
+	})
+}
@@ -0,0 +1,24 @@
+package smartcache
+
+// Option config engine when Start, *CollectionConfig is an Option too
+type Option interface {
+	apply(e *Engine) error
+}
+
+type optionFunc func(e *Engine) error
+
+func (f optionFunc) apply(e *Engine) error {
+	return f(e)
+}
+
+func (cf *CollectionConfig) apply(e *Engine) error {
+	return e.AddCollection(cf)
+}
+
+// WithCodec set codec encode values of snapshot, default is GobCodec
+func WithCodec(codec Codec) Option {
+	return optionFunc(func(e *Engine) error {
+		e.codec = codec
+		return nil
+	})
+}
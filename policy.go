@@ -0,0 +1,200 @@
+package smartcache
+
+import (
+	"fmt"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/hashicorp/golang-lru/simplelru"
+)
+
+// EvictionPolicy is how a full collection choose item to evict
+type EvictionPolicy int
+
+const (
+	// PolicyLRU evict least recently used item
+	PolicyLRU EvictionPolicy = iota
+	// PolicyLFU evict least frequently used item, oldest first when same frequency
+	PolicyLFU
+	// Policy2Q keep items used once apart from items used more, so a scan don't flush hot items
+	Policy2Q
+	// PolicyARC balance recency and frequency by itself
+	PolicyARC
+	// PolicyTinyLFU is W-TinyLFU, new item only replace an item used less often
+	PolicyTinyLFU
+)
+
+func (p EvictionPolicy) String() string {
+	switch p {
+	case PolicyLRU:
+		return "lru"
+	case PolicyLFU:
+		return "lfu"
+	case Policy2Q:
+		return "2q"
+	case PolicyARC:
+		return "arc"
+	case PolicyTinyLFU:
+		return "tinylfu"
+	}
+	return "unknown"
+}
+
+func (p EvictionPolicy) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// UnmarshalText read policy from name like "lfu", used by config file
+func (p *EvictionPolicy) UnmarshalText(text []byte) error {
+	for kind := PolicyLRU; kind <= PolicyTinyLFU; kind++ {
+		if kind.String() == string(text) {
+			*p = kind
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown eviction policy %q", text)
+}
+
+/**
+policy is eviction algorithm of a segment, segment lock it so it need not be safe for concurrent call.
+Add return true when an item was evicted to make space, evicted item is passed to callback
+of constructor when policy can tell it.
+*/
+type policy interface {
+	Add(key, value interface{}) bool
+	Get(key interface{}) (interface{}, bool)
+	Peek(key interface{}) (interface{}, bool)
+	Contains(key interface{}) bool
+	Remove(key interface{}) bool
+	Keys() []interface{}
+	Len() int
+	Resize(size int) int
+	Purge()
+	// RemoveOldest evict item policy would evict next
+	RemoveOldest() (interface{}, interface{}, bool)
+}
+
+func newPolicy(kind EvictionPolicy, size int, onEvict simplelru.EvictCallback) (policy, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("must provide a positive size")
+	}
+	switch kind {
+	case PolicyLRU:
+		return simplelru.NewLRU(size, onEvict)
+	case PolicyLFU:
+		return newLFU(size, onEvict), nil
+	case Policy2Q:
+		return newLibPolicy(size, func(size int) (libCache, error) { return lru.New2Q(size) })
+	case PolicyARC:
+		return newLibPolicy(size, func(size int) (libCache, error) { return lru.NewARC(size) })
+	case PolicyTinyLFU:
+		return newTinyLFU(size, onEvict), nil
+	}
+	return nil, fmt.Errorf("unknown eviction policy %d", kind)
+}
+
+// libCache is 2Q, ARC cache of golang-lru
+type libCache interface {
+	Add(key, value interface{})
+	Get(key interface{}) (interface{}, bool)
+	Peek(key interface{}) (interface{}, bool)
+	Contains(key interface{}) bool
+	Remove(key interface{})
+	Keys() []interface{}
+	Len() int
+	Purge()
+}
+
+/**
+libPolicy adapt 2Q, ARC of golang-lru to policy.
+They don't tell evicted item, so eviction is known by length but evict hooks are not fired.
+They can't resize, so Resize build a new cache and add items again.
+*/
+type libPolicy struct {
+	cache libCache
+	size  int
+	build func(size int) (libCache, error)
+}
+
+func newLibPolicy(size int, build func(size int) (libCache, error)) (*libPolicy, error) {
+	cache, err := build(size)
+	if err != nil {
+		return nil, err
+	}
+	return &libPolicy{cache: cache, size: size, build: build}, nil
+}
+
+func (p *libPolicy) Add(key, value interface{}) bool {
+	if p.cache.Contains(key) {
+		p.cache.Add(key, value)
+		return false
+	}
+	n := p.cache.Len()
+	p.cache.Add(key, value)
+	return p.cache.Len() <= n
+}
+
+func (p *libPolicy) Get(key interface{}) (interface{}, bool) {
+	return p.cache.Get(key)
+}
+
+func (p *libPolicy) Peek(key interface{}) (interface{}, bool) {
+	return p.cache.Peek(key)
+}
+
+func (p *libPolicy) Contains(key interface{}) bool {
+	return p.cache.Contains(key)
+}
+
+func (p *libPolicy) Remove(key interface{}) bool {
+	if !p.cache.Contains(key) {
+		return false
+	}
+	p.cache.Remove(key)
+	return true
+}
+
+func (p *libPolicy) Keys() []interface{} {
+	return p.cache.Keys()
+}
+
+func (p *libPolicy) Len() int {
+	return p.cache.Len()
+}
+
+func (p *libPolicy) Resize(size int) int {
+	cache, err := p.build(size)
+	if err != nil {
+		return 0
+	}
+	n := p.cache.Len()
+	for _, key := range p.cache.Keys() {
+		if value, ok := p.cache.Peek(key); ok {
+			cache.Add(key, value)
+		}
+	}
+	p.cache, p.size = cache, size
+	if evicted := n - cache.Len(); evicted > 0 {
+		return evicted
+	}
+	return 0
+}
+
+func (p *libPolicy) Purge() {
+	p.cache.Purge()
+}
+
+// RemoveOldest remove first key of cache, they don't tell which key they evict next
+func (p *libPolicy) RemoveOldest() (interface{}, interface{}, bool) {
+	keys := p.cache.Keys()
+	if len(keys) == 0 {
+		return nil, nil, false
+	}
+	value, _ := p.cache.Peek(keys[0])
+	p.cache.Remove(keys[0])
+	return keys[0], value, true
+}
+
+// weighable tell policy can tell items evicted, so bytes of segment can be counted
+func weighable(kind EvictionPolicy) bool {
+	return kind != Policy2Q && kind != PolicyARC
+}
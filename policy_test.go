@@ -0,0 +1,114 @@
+package smartcache
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"testing"
+	"time"
+)
+
+var allPolicies = []EvictionPolicy{PolicyLRU, PolicyLFU, Policy2Q, PolicyARC, PolicyTinyLFU}
+
+func TestPolicyBasic(t *testing.T) {
+	for _, kind := range allPolicies {
+		evicted := 0
+		p, err := newPolicy(kind, 10, func(key, value interface{}) { evicted++ })
+		if err != nil {
+			t.Fatal(err)
+		}
+		anyEvicted := false
+		for i := 0; i < 20; i++ {
+			if p.Add(i, i) {
+				anyEvicted = true
+			}
+		}
+		if p.Len() != 10 || len(p.Keys()) != 10 || !anyEvicted {
+			log.Print(kind, " ", p.Len(), p.Keys())
+			t.Fail()
+		}
+		key := p.Keys()[0]
+		if v, ok := p.Peek(key); !ok || v != key {
+			t.Fail()
+		}
+		if !p.Remove(key) || p.Remove(key) || p.Contains(key) {
+			log.Print(kind, " remove")
+			t.Fail()
+		}
+		if n := p.Resize(5); n != 4 || p.Len() != 5 {
+			log.Print(kind, " resize ", n, p.Len())
+			t.Fail()
+		}
+		p.Purge()
+		if p.Len() != 0 {
+			t.Fail()
+		}
+		if kind != Policy2Q && kind != PolicyARC && evicted == 0 {
+			log.Print(kind, " evict callback")
+			t.Fail()
+		}
+	}
+}
+
+func TestPolicyLFU(t *testing.T) {
+	p := newLFU(3, nil)
+	p.Add("a", 1)
+	p.Add("b", 2)
+	p.Add("c", 3)
+	p.Get("a")
+	p.Get("a")
+	p.Get("c")
+	// b is used least
+	p.Add("d", 4)
+	if p.Contains("b") || !p.Contains("a") || !p.Contains("c") {
+		log.Print(p.Keys())
+		t.Fail()
+	}
+	// d is least used, then c, then a
+	if fmt.Sprint(p.Keys()) != "[d c a]" {
+		log.Print(p.Keys())
+		t.Fail()
+	}
+}
+
+// hot keys used many times then a scan of keys used once, hot keys should survive
+func TestPolicyScanResistant(t *testing.T) {
+	for _, kind := range []EvictionPolicy{PolicyLFU, Policy2Q, PolicyARC, PolicyTinyLFU} {
+		p, _ := newPolicy(kind, 100, nil)
+		for round := 0; round < 5; round++ {
+			for i := 0; i < 50; i++ {
+				if _, ok := p.Get(i); !ok {
+					p.Add(i, i)
+				}
+			}
+		}
+		for i := 1000; i < 2000; i++ {
+			p.Add(i, i)
+		}
+		hot := 0
+		for i := 0; i < 50; i++ {
+			if p.Contains(i) {
+				hot++
+			}
+		}
+		log.Print(kind, " hot keys left ", hot)
+		if hot < 40 {
+			t.Fail()
+		}
+	}
+}
+
+func TestCollectionPolicy(t *testing.T) {
+	for _, kind := range allPolicies {
+		e := Start(&CollectionConfig{Key: "p", Capacity: 3, ExpireDuration: 10 * time.Second, Policy: kind, Shards: 1})
+		var err error
+		for i := 0; i < 4; i++ {
+			err = e.Select(context.TODO(), "p").Upsert(i, i)
+		}
+		col := e.Collection()["p"]
+		if err == nil || err.Error() != E_upsert_problem || col.Len() != 3 || col.Stats().Evictions != 1 {
+			log.Print(kind, " ", err, col.Len(), col.Stats().Evictions)
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package smartcache
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+)
+
+// PreloadFn fill collection by put before it's used, put is safe to call from many goroutines
+type PreloadFn func(ctx context.Context, put func(key, value interface{})) error
+
+// WithPreloadParallelism run preload of n collections at the same time, default is 1
+func WithPreloadParallelism(n int) Option {
+	return optionFunc(func(e *Engine) error {
+		e.preloadParallelism = n
+		return nil
+	})
+}
+
+/**
+preload run Preload of config, it return E_preload_timeout when PreloadTimeout passed.
+Items put after timeout are dropped.
+*/
+func (c *Collection) preload(cf *CollectionConfig) error {
+	if cf.Preload == nil {
+		return nil
+	}
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if cf.PreloadTimeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), cf.PreloadTimeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	defer cancel()
+	// puts hold read lock while writing, finish wait them so no item is put after preload return
+	var lock sync.RWMutex
+	done := false
+	put := func(key, value interface{}) {
+		lock.RLock()
+		defer lock.RUnlock()
+		if done {
+			return
+		}
+		c.upsert(key, value, 0, ReasonLoad)
+	}
+	finish := func() {
+		lock.Lock()
+		done = true
+		lock.Unlock()
+	}
+	errc := make(chan error, 1)
+	go func() {
+		errc <- cf.Preload(ctx, put)
+	}()
+	select {
+	case err := <-errc:
+		finish()
+		return err
+	case <-ctx.Done():
+		finish()
+		return errors.New(E_preload_timeout)
+	}
+}
+
+// preload run preload of collections, at most preloadParallelism at the same time
+func (e *Engine) preload(cols []*Collection, cfs []*CollectionConfig) error {
+	n := e.preloadParallelism
+	if n < 1 {
+		n = 1
+	}
+	sem := make(chan struct{}, n)
+	wg := &sync.WaitGroup{}
+	errs := make([]error, len(cols))
+	for i := range cols {
+		if cfs[i].Preload == nil {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := cols[i].preload(cfs[i]); err != nil {
+				log.Print("preload fail ", cols[i].key, " ", err)
+				errs[i] = err
+			}
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
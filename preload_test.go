@@ -0,0 +1,108 @@
+package smartcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPreload(t *testing.T) {
+	var running, maxRunning int32
+	preload := func(n int) PreloadFn {
+		return func(ctx context.Context, put func(key, value interface{})) error {
+			cur := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+			for {
+				old := atomic.LoadInt32(&maxRunning)
+				if cur <= old || atomic.CompareAndSwapInt32(&maxRunning, old, cur) {
+					break
+				}
+			}
+			time.Sleep(50 * time.Millisecond)
+			for i := 0; i < n; i++ {
+				put(fmt.Sprintf("k%d", i), i)
+			}
+			return nil
+		}
+	}
+	e := StartWithOptions(
+		WithPreloadParallelism(2),
+		&CollectionConfig{Key: "countries", Capacity: 100, Preload: preload(10)},
+		&CollectionConfig{Key: "currencies", Capacity: 100, Preload: preload(20)},
+		&CollectionConfig{Key: "categories", Capacity: 100, Preload: preload(30)},
+	)
+	if e.Collection()["countries"].Len() != 10 || e.Collection()["currencies"].Len() != 20 || e.Collection()["categories"].Len() != 30 {
+		t.Fail()
+	}
+	if atomic.LoadInt32(&maxRunning) != 2 {
+		log.Print("max running ", maxRunning)
+		t.Fail()
+	}
+	var out int
+	hit, _ := e.Select(context.TODO(), "currencies").Get("k5", nil).Exec(&out)
+	if !hit || out != 5 {
+		t.Fail()
+	}
+}
+
+func TestPreloadFail(t *testing.T) {
+	e := Start()
+	err := e.AddCollection(
+		&CollectionConfig{Key: "ok", Capacity: 10, Preload: func(ctx context.Context, put func(key, value interface{})) error {
+			put("k1", 1)
+			return nil
+		}},
+		&CollectionConfig{Key: "slow", Capacity: 10, PreloadTimeout: 50 * time.Millisecond, Preload: func(ctx context.Context, put func(key, value interface{})) error {
+			time.Sleep(200 * time.Millisecond)
+			return nil
+		}},
+	)
+	if err == nil || err.Error() != E_preload_timeout {
+		log.Print(err)
+		t.Fail()
+	}
+	if len(e.Collection()) != 0 {
+		t.Fail()
+	}
+	err = e.AddCollection(&CollectionConfig{Key: "broken", Capacity: 10, Preload: func(ctx context.Context, put func(key, value interface{})) error {
+		return errors.New("db down")
+	}})
+	if err == nil || len(e.Collection()) != 0 {
+		t.Fail()
+	}
+}
+
+func TestPreloadTimeoutNoPut(t *testing.T) {
+	col, _ := CreateCollection(&CollectionConfig{Key: "pt", Capacity: 100000})
+	defer col.Close()
+	stop := make(chan struct{})
+	defer close(stop)
+	err := col.preload(&CollectionConfig{
+		PreloadTimeout: 20 * time.Millisecond,
+		// preload ignore ctx and keep putting
+		Preload: func(ctx context.Context, put func(key, value interface{})) error {
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return nil
+				default:
+				}
+				put(i, i)
+			}
+		},
+	})
+	if err == nil || err.Error() != E_preload_timeout {
+		log.Print(err)
+		t.Fail()
+	}
+	n := col.Len()
+	time.Sleep(20 * time.Millisecond)
+	if col.Len() != n {
+		log.Print(n, col.Len())
+		t.Fail()
+	}
+}
@@ -0,0 +1,79 @@
+package smartcache
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+const defaultRefreshQueueSize = 100
+
+// startRefresh start workers reload items read near their deadline, when RefreshAhead and Loader are set
+func (c *Collection) startRefresh(config *CollectionConfig) {
+	if config.RefreshAhead <= 0 || config.RefreshAhead >= 1 || len(config.Loader)+len(config.CtxLoader) == 0 {
+		return
+	}
+	workers := config.RefreshWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	size := config.RefreshQueueSize
+	if size < 1 {
+		size = defaultRefreshQueueSize
+	}
+	c.refreshAhead = config.RefreshAhead
+	c.loader = c.retryGetters(c.retry, append(c.ctxGetters(config.Loader), config.CtxLoader...))
+	c.refreshQueue = make(chan interface{}, size)
+	for i := 0; i < workers; i++ {
+		c.workers.Add(1)
+		go c.refreshWorker()
+	}
+}
+
+func (c *Collection) refreshWorker() {
+	defer c.workers.Done()
+	for {
+		select {
+		case key := <-c.refreshQueue:
+			c.refresh(key)
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// refresh reload key by loader, ctx of loader is done when collection closed so Close don't wait it
+func (c *Collection) refresh(key interface{}) {
+	ctx, cancel := c.stopContext(context.Background())
+	defer cancel()
+	if _, err, _ := c.flight.do(key, c.loadFn(ctx, key, c.loader, false, false)); err == nil {
+		c.stats.refreshed()
+	}
+}
+
+// refreshAt is time value should be reloaded, 0 is never
+func (c *Collection) refreshAt(deadline int64, ttl int64) int64 {
+	if c.refreshQueue == nil || deadline == 0 {
+		return 0
+	}
+	return deadline - int64(float64(ttl)*c.refreshAhead)
+}
+
+/**
+maybeRefresh queue key to reload when value is read after its refreshAt.
+A value is queued once, when queue is full it's dropped and next read try again.
+*/
+func (c *Collection) maybeRefresh(key interface{}, colValue *CollectionValue, now int64) {
+	at := atomic.LoadInt64(&colValue.refreshAt)
+	if at == 0 || now < at {
+		return
+	}
+	if !atomic.CompareAndSwapInt64(&colValue.refreshAt, at, 0) {
+		return
+	}
+	select {
+	case c.refreshQueue <- key:
+	default:
+		atomic.StoreInt64(&colValue.refreshAt, at)
+		c.stats.refreshDropped()
+	}
+}
@@ -0,0 +1,123 @@
+package smartcache
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+/**
+RetryPolicy call getter, setter again when it return retryable error.
+Wait before attempt n is Backoff * Multiplier^(n-2), not more than MaxBackoff,
+then changed randomly by Jitter percent. Waiting stop when ctx of session is done.
+*/
+type RetryPolicy struct {
+	// MaxAttempts is number of calls include the first, less than 2 is no retry
+	MaxAttempts int
+	// Backoff is wait before second attempt, default 10ms
+	Backoff time.Duration
+	// MaxBackoff is max wait between attempts, 0 is no limit
+	MaxBackoff time.Duration
+	// Multiplier is how wait grow after each attempt, default 2
+	Multiplier float64
+	// Jitter in [0, 1] is percent of wait changed randomly
+	Jitter float64
+	// Retryable decide error is retried, nil retry all errors
+	Retryable func(err error) bool
+}
+
+// wait return time wait before attempt, attempt start from 2
+func (p *RetryPolicy) wait(attempt int) time.Duration {
+	backoff := p.Backoff
+	if backoff <= 0 {
+		backoff = 10 * time.Millisecond
+	}
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+	d := float64(backoff)
+	for i := 2; i < attempt; i++ {
+		d *= multiplier
+		if p.MaxBackoff > 0 && d >= float64(p.MaxBackoff) {
+			break
+		}
+	}
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		d += d * p.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(d)
+}
+
+func (p *RetryPolicy) retryable(err error) bool {
+	if isCircuitOpen(err) {
+		return false
+	}
+	if p.Retryable == nil {
+		return true
+	}
+	return p.Retryable(err)
+}
+
+/**
+do call fn until it success, error is not retryable or MaxAttempts reached.
+retries is increased by number of attempts after the first.
+When ctx is done while waiting, E_cancelled is returned.
+*/
+func (p *RetryPolicy) do(ctx context.Context, retries *uint64, fn func() error) error {
+	err := fn()
+	if p == nil {
+		return err
+	}
+	for attempt := 2; err != nil && attempt <= p.MaxAttempts && p.retryable(err); attempt++ {
+		timer := time.NewTimer(p.wait(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.New(E_cancelled)
+		case <-timer.C:
+		}
+		atomic.AddUint64(retries, 1)
+		err = fn()
+	}
+	return err
+}
+
+// retryGetters wrap getters to retry by policy
+func (c *Collection) retryGetters(p *RetryPolicy, getterFns []CtxGetterFn) []CtxGetterFn {
+	if p == nil || p.MaxAttempts < 2 {
+		return getterFns
+	}
+	out := make([]CtxGetterFn, 0, len(getterFns))
+	for _, f := range getterFns {
+		f := f
+		out = append(out, func(ctx context.Context, collection string, key interface{}) (interface{}, error) {
+			var val interface{}
+			err := p.do(ctx, &c.stats.loadRetries, func() (err error) {
+				val, err = f(ctx, collection, key)
+				return err
+			})
+			return val, err
+		})
+	}
+	return out
+}
+
+// Retry set retry policy of getters, setters called by this session, it replace policy of collection
+func (s *Session) Retry(p *RetryPolicy) *Session {
+	s.retry = p
+	return s
+}
+
+// retryPolicy return policy of session or of collection
+func (s *Session) retryPolicy() *RetryPolicy {
+	if s.retry != nil {
+		return s.retry
+	}
+	return s.collection.retry
+}
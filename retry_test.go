@@ -0,0 +1,76 @@
+package smartcache
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryGetter(t *testing.T) {
+	e := Start(&CollectionConfig{
+		Key: "retry", Capacity: 10, ExpireDuration: 10 * time.Second,
+		Retry: &RetryPolicy{MaxAttempts: 3, Backoff: 5 * time.Millisecond, Jitter: 0.5},
+	})
+	var called int32
+	flaky := func(i interface{}) (interface{}, error) {
+		if atomic.AddInt32(&called, 1) < 3 {
+			return nil, errors.New("timeout")
+		}
+		return 10, nil
+	}
+	var out int
+	hit, err := e.Select(context.TODO(), "retry").Get("k1", nil, flaky).Exec(&out)
+	if !hit || err != nil || out != 10 || called != 3 {
+		log.Print(hit, err, out, called)
+		t.Fail()
+	}
+	stats := e.Collection()["retry"].Stats()
+	if stats.LoadRetries != 2 || stats.Loads != 1 {
+		log.Printf("%+v", stats)
+		t.Fail()
+	}
+
+	// error not retryable
+	called = 0
+	notFound := errors.New("not found")
+	policy := &RetryPolicy{MaxAttempts: 5, Retryable: func(err error) bool { return err != notFound }}
+	e.Select(context.TODO(), "retry").Retry(policy).Get("k2", nil, func(i interface{}) (interface{}, error) {
+		atomic.AddInt32(&called, 1)
+		return nil, notFound
+	}).Exec(&out)
+	if called != 1 {
+		t.Fail()
+	}
+}
+
+func TestRetryCancelled(t *testing.T) {
+	e := Start(&CollectionConfig{Key: "retryctx", Capacity: 10, ExpireDuration: 10 * time.Second})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	var called int32
+	setter := func(k, v interface{}) error {
+		atomic.AddInt32(&called, 1)
+		return errors.New("write fail")
+	}
+	start := time.Now()
+	err := e.Select(ctx, "retryctx").Retry(&RetryPolicy{MaxAttempts: 10, Backoff: 30 * time.Millisecond}).Upsert("k1", 1, setter)
+	if err == nil || err.Error() != E_cancelled || time.Since(start) > 200*time.Millisecond {
+		log.Print(err, time.Since(start))
+		t.Fail()
+	}
+	if called != 2 || e.Collection()["retryctx"].Stats().SetterRetries != 1 {
+		log.Print(called)
+		t.Fail()
+	}
+}
+
+func TestRetryWait(t *testing.T) {
+	p := &RetryPolicy{Backoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}
+	if p.wait(2) != 10*time.Millisecond || p.wait(3) != 20*time.Millisecond || p.wait(10) != 50*time.Millisecond {
+		log.Print(p.wait(2), p.wait(3), p.wait(10))
+		t.Fail()
+	}
+}
@@ -4,20 +4,28 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"log"
 	"reflect"
+	"time"
 )
 
 type GetterFn func(interface{}) (interface{}, error)
 
 type SetterFn func(interface{}, interface{}) error
 
+// CtxGetterFn is GetterFn receive ctx of session, key of collection and the original key
+type CtxGetterFn func(ctx context.Context, collection string, key interface{}) (interface{}, error)
+
+// CtxSetterFn is SetterFn receive ctx of session, key of collection and the original key
+type CtxSetterFn func(ctx context.Context, collection string, key, value interface{}) error
+
 type Session struct {
 	ctx        context.Context
 	collection *Collection
 	out        interface{}
 	err        error
+	stale      bool
+	retry      *RetryPolicy
 }
 
 type SessionConfig struct {
@@ -49,44 +57,87 @@ func createSession(cf *SessionConfig) *Session {
 func (s *Session) Close() {
 	s.out = nil
 	s.err = nil
+	s.stale = false
+	s.retry = nil
 	s.ctx = nil
 }
+
+// context return ctx of session, session reused after Exec has no ctx
+func (s *Session) context() context.Context {
+	if s.ctx == nil {
+		return context.TODO()
+	}
+	return s.ctx
+}
+
 func (s *Session) KeyBulder(sim interface{}) interface{} {
-	return fmt.Sprintf("%v.%v", s.collection.Key(), sim)
+	return s.collection.buildKey(sim)
+}
+
+// load get value of key, run getters to fill collection when key not existed.
+// Concurrent loads of same key run getters once and share result.
+// With StaleWhileRevalidate, an expired value in window is returned and refreshed in background.
+func (s *Session) load(key interface{}, getterFns []CtxGetterFn) (interface{}, bool) {
+	getterFns = s.collection.retryGetters(s.retryPolicy(), getterFns)
+	colValue, stale, has := s.collection.lookupStale(key)
+	if has && colValue.isNegative() {
+		s.collection.stats.negativeHit()
+		s.err = errors.New(E_not_found)
+		return nil, false
+	}
+	if has && (!stale || len(getterFns) > 0) {
+		s.collection.stats.hit(true)
+		if stale {
+			s.stale = true
+			s.collection.stats.staleHit()
+			// refresh outlive the request, so it don't use ctx of session
+			col := s.collection
+			col.revalidate(key, func(ctx context.Context) func() (interface{}, error) {
+				return col.loadFn(ctx, key, getterFns, true, false)
+			})
+		}
+		return colValue.Value, true
+	}
+	s.collection.stats.hit(false)
+	if len(getterFns) == 0 {
+		return nil, false
+	}
+	col := s.collection
+	val, err := col.loadShared(s.context(), key, func(ctx context.Context) func() (interface{}, error) {
+		return col.loadFn(ctx, key, getterFns, true, true)
+	})
+	switch {
+	case err == nil:
+	case s.context().Err() != nil:
+		s.err = errors.New(E_cancelled)
+	case err.Error() != E_cancelled && s.collection.settings().negativeTTL > 0:
+		s.err = errors.New(E_not_found)
+	}
+	return val, err == nil
 }
 
 func (s *Session) Filter(key interface{}, iter func(interface{}, int) bool, getterFns ...GetterFn) *Session {
 	if s.err != nil {
 		return s
 	}
-	if !s.collection.IsKeyExisted(key) {
-		isok := false
-		for _, f := range getterFns {
-			val, err := f(s.KeyBulder(key))
-			if err != nil {
-				continue
-			}
-			if val != nil {
-				if err := s.collection.Upsert(s.ctx, key, val); err != nil {
-					continue
-				}
-			}
-			isok = true
-			break
-		}
-		if !isok {
-			return s
-		}
+	return s.FilterWith(key, iter, s.collection.ctxGetters(getterFns)...)
+}
+
+// FilterWith is Filter with getters receive ctx of session
+func (s *Session) FilterWith(key interface{}, iter func(interface{}, int) bool, getterFns ...CtxGetterFn) *Session {
+	if s.err != nil {
+		return s
+	}
+	val, ok := s.load(key, getterFns)
+	if !ok {
+		return s
 	}
 	if iter == nil {
-		val, ok := s.collection.Get(s.ctx, key)
-		if ok {
-			s.out = val
-		}
+		s.out = val
 		return s
 	}
 	out := make([]interface{}, 0, 10)
-	s.collection.Iter(s.ctx, key, func(data interface{}, index int) {
+	iterSlice(val, func(data interface{}, index int) {
 		if ok := iter(data, index); ok {
 			out = append(out, data)
 		}
@@ -99,34 +150,29 @@ func (s *Session) Get(key interface{}, iter func(interface{}, int) bool, getterF
 	if s.err != nil {
 		return s
 	}
-	if !s.collection.IsKeyExisted(key) {
-		isok := false
-		for _, f := range getterFns {
-			val, err := f(s.KeyBulder(key))
-			if err != nil {
-				continue
-			}
-			if val != nil {
-				if err := s.collection.Upsert(s.ctx, key, val); err != nil {
-					continue
-				}
-			}
-			isok = true
-			break
-		}
-		if !isok {
-			return s
-		}
+	return s.GetWith(key, iter, s.collection.ctxGetters(getterFns)...)
+}
+
+/**
+GetWith is Get with getters receive ctx, key of collection and the original key.
+Load is shared by sessions read same key, so getters don't receive ctx of session:
+their ctx keep values of session and it's done after CollectionConfig.LoadTimeout or when collection closed.
+Session stop waiting when its own ctx is done and Exec return E_cancelled, load keep running for others.
+*/
+func (s *Session) GetWith(key interface{}, iter func(interface{}, int) bool, getterFns ...CtxGetterFn) *Session {
+	if s.err != nil {
+		return s
+	}
+	val, ok := s.load(key, getterFns)
+	if !ok {
+		return s
 	}
 	if iter == nil {
-		val, ok := s.collection.Get(s.ctx, key)
-		if ok {
-			s.out = val
-		}
+		s.out = val
 		return s
 	}
 	isdone := false
-	s.collection.Iter(s.ctx, key, func(data interface{}, index int) {
+	iterSlice(val, func(data interface{}, index int) {
 		if ok := iter(data, index); ok && !isdone {
 			s.out = data
 			isdone = true
@@ -135,6 +181,13 @@ func (s *Session) Get(key interface{}, iter func(interface{}, int) bool, getterF
 	return s
 }
 
+// ExecStale is Exec and also tell value is stale, it's being refreshed in background
+func (s *Session) ExecStale(outptr interface{}) (hit bool, stale bool, err error) {
+	stale = s.stale
+	hit, err = s.Exec(outptr)
+	return hit, stale && hit, err
+}
+
 func (s *Session) Exec(outptr interface{}) (bool, error) {
 	defer s.Close()
 	if s.err != nil {
@@ -166,43 +219,86 @@ func (s *Session) Exec(outptr interface{}) (bool, error) {
 }
 
 func (s *Session) Upsert(key interface{}, value interface{}, setterFns ...SetterFn) error {
-	err := s.collection.Upsert(s.ctx, key, value)
-	if len(setterFns) == 0 {
-		return err
+	return s.UpsertTTL(key, value, 0, setterFns...)
+}
+
+// UpsertTTL upsert value live in ttl, ttl 0 use ExpireDuration of collection
+func (s *Session) UpsertTTL(key interface{}, value interface{}, ttl time.Duration, setterFns ...SetterFn) error {
+	if s.err != nil {
+		return s.err
 	}
-	if err != nil {
-		return err
+	return s.UpsertTTLWith(key, value, ttl, s.collection.ctxSetters(setterFns)...)
+}
+
+// UpsertWith is Upsert with setters receive ctx of session
+func (s *Session) UpsertWith(key interface{}, value interface{}, setterFns ...CtxSetterFn) error {
+	return s.UpsertTTLWith(key, value, 0, setterFns...)
+}
+
+// UpsertTTLWith is UpsertTTL with setters receive ctx of session
+func (s *Session) UpsertTTLWith(key interface{}, value interface{}, ttl time.Duration, setterFns ...CtxSetterFn) error {
+	if s.err != nil {
+		return s.err
 	}
-	errstr := ""
-	for _, f := range setterFns {
-		err := f(s.KeyBulder(key), value)
-		if err != nil {
-			errstr += err.Error()
+	if s.collection.writeThrough && len(setterFns) > 0 {
+		if err := s.set(key, value, setterFns); err != nil {
+			return err
 		}
+		return s.collection.UpsertTTL(s.ctx, key, value, ttl)
 	}
-	if errstr != "" {
-		return errors.New(errstr)
+	if err := s.collection.UpsertTTL(s.ctx, key, value, ttl); err != nil {
+		return err
 	}
-	return nil
+	return s.set(key, value, setterFns)
 }
 
 func (s *Session) Delete(key interface{}, setterFns ...SetterFn) error {
-	err := s.collection.Delete(s.ctx, key)
-	if len(setterFns) == 0 {
-		return err
+	if s.err != nil {
+		return s.err
+	}
+	return s.DeleteWith(key, s.collection.ctxSetters(setterFns)...)
+}
+
+// DeleteWith is Delete with setters receive ctx of session
+func (s *Session) DeleteWith(key interface{}, setterFns ...CtxSetterFn) error {
+	if s.err != nil {
+		return s.err
+	}
+	if s.collection.writeThrough && len(setterFns) > 0 {
+		if err := s.set(key, nil, setterFns); err != nil {
+			return err
+		}
+		return s.collection.Delete(s.ctx, key)
 	}
-	if err != nil {
+	if err := s.collection.Delete(s.ctx, key); err != nil {
 		return err
 	}
-	errstr := ""
-	for _, f := range setterFns {
-		err := f(s.KeyBulder(key), nil)
+	return s.set(key, nil, setterFns)
+}
+
+// set run all setters, it stop when ctx is done and return E_cancelled.
+// Setters failed are returned by *SetterError
+func (s *Session) set(key, value interface{}, setterFns []CtxSetterFn) error {
+	serr := &SetterError{Collection: s.collection.key, Key: key, CacheChanged: !s.collection.writeThrough}
+	ctx := s.context()
+	policy := s.retryPolicy()
+	for i, f := range setterFns {
+		if ctx.Err() != nil {
+			return errors.New(E_cancelled)
+		}
+		err := policy.do(ctx, &s.collection.stats.setterRetries, func() error {
+			return f(ctx, s.collection.key, key, value)
+		})
+		if err != nil && err.Error() == E_cancelled {
+			return err
+		}
 		if err != nil {
-			errstr += err.Error()
+			s.collection.stats.setterFailed()
+			serr.add(i, err)
 		}
 	}
-	if errstr != "" {
-		return errors.New(errstr)
+	if len(serr.Failures) > 0 {
+		return serr
 	}
 	return nil
 }
@@ -5,6 +5,8 @@ import (
 	"errors"
 	"log"
 	"reflect"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -241,3 +243,329 @@ func TestX(t *testing.T) {
 	// hit := x(&out, "c1")
 	// log.Print(hit, out, &out)
 }
+
+func TestSessionLoadCoalesced(t *testing.T) {
+	e := Start(&CollectionConfig{Key: "col", Capacity: 100, ExpireDuration: 10 * time.Second})
+	var called int32
+	getter := func(key interface{}) (interface{}, error) {
+		atomic.AddInt32(&called, 1)
+		time.Sleep(100 * time.Millisecond)
+		return 10, nil
+	}
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var out int
+			hit, _ := e.Select(context.TODO(), "col").Get("k1", nil, getter).Exec(&out)
+			if !hit || out != 10 {
+				log.Print(hit, out)
+				t.Fail()
+			}
+		}()
+	}
+	wg.Wait()
+	log.Print(called, e.Collection()["col"].Coalesced())
+	if atomic.LoadInt32(&called) != 1 {
+		t.Fail()
+	}
+	if e.Collection()["col"].Coalesced() == 0 {
+		t.Fail()
+	}
+}
+
+func TestSessionStaleWhileRevalidate(t *testing.T) {
+	e := Start(&CollectionConfig{Key: "swr", Capacity: 10, ExpireDuration: 100 * time.Millisecond, StaleWhileRevalidate: time.Second})
+	var called int32
+	getter := func(i interface{}) (interface{}, error) {
+		n := atomic.AddInt32(&called, 1)
+		time.Sleep(50 * time.Millisecond)
+		return int(n) * 10, nil
+	}
+	e.Select(context.TODO(), "swr").Upsert("k1", 1)
+	time.Sleep(150 * time.Millisecond)
+
+	// without getters stale value is a miss
+	var out int
+	if hit, _ := e.Select(context.TODO(), "swr").Get("k1", nil).Exec(&out); hit {
+		t.Fail()
+	}
+	for i := 0; i < 5; i++ {
+		start := time.Now()
+		hit, stale, _ := e.Select(context.TODO(), "swr").Get("k1", nil, getter).ExecStale(&out)
+		if !hit || !stale || out != 1 || time.Since(start) > 20*time.Millisecond {
+			log.Print(hit, stale, out)
+			t.Fail()
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+	if atomic.LoadInt32(&called) != 1 {
+		log.Print("only one refresh ", called)
+		t.Fail()
+	}
+	hit, stale, _ := e.Select(context.TODO(), "swr").Get("k1", nil, getter).ExecStale(&out)
+	if !hit || stale || out != 10 {
+		log.Print(hit, stale, out)
+		t.Fail()
+	}
+	if e.Collection()["swr"].Stats().StaleHits != 5 {
+		t.Fail()
+	}
+
+	// out of stale window, GC remove it
+	e.Select(context.TODO(), "swr").UpsertTTL("k2", 2, time.Millisecond)
+	col := e.Collection()["swr"]
+	time.Sleep(10 * time.Millisecond)
+	col.GC()
+	if !col.data.Contains("k2") {
+		t.Fail()
+	}
+	col.staleWindow = 0
+	col.GC()
+	if col.data.Contains("k2") {
+		t.Fail()
+	}
+}
+
+func TestSessionRevalidateClose(t *testing.T) {
+	e := Start(&CollectionConfig{Key: "swrclose", Capacity: 10, ExpireDuration: 50 * time.Millisecond, StaleWhileRevalidate: time.Second})
+	var running, called int32
+	getter := func(ctx context.Context, collection string, key interface{}) (interface{}, error) {
+		atomic.AddInt32(&called, 1)
+		atomic.StoreInt32(&running, 1)
+		defer atomic.StoreInt32(&running, 0)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	e.Select(context.TODO(), "swrclose").Upsert("k1", 1)
+	e.Select(context.TODO(), "swrclose").Upsert("k2", 2)
+	time.Sleep(60 * time.Millisecond)
+	var out int
+	if _, err := e.Select(context.TODO(), "swrclose").GetWith("k1", nil, getter).Exec(&out); err != nil || out != 1 {
+		log.Print(err, out)
+		t.Fail()
+	}
+	time.Sleep(20 * time.Millisecond)
+	// close stop refresh and wait it exit
+	e.Close(context.TODO())
+	if atomic.LoadInt32(&running) != 0 || atomic.LoadInt32(&called) != 1 {
+		log.Print(running, called)
+		t.Fail()
+	}
+	// no refresh start after close
+	col := e.Collection()["swrclose"]
+	createSession(&SessionConfig{collection: col, ctx: context.TODO()}).GetWith("k2", nil, getter).Exec(&out)
+	time.Sleep(20 * time.Millisecond)
+	if atomic.LoadInt32(&called) != 1 {
+		log.Print(called)
+		t.Fail()
+	}
+}
+
+func TestSessionNegativeTTL(t *testing.T) {
+	e := Start(&CollectionConfig{Key: "neg", Capacity: 10, ExpireDuration: 10 * time.Second, NegativeTTL: 100 * time.Millisecond})
+	var called int32
+	getter := func(i interface{}) (interface{}, error) {
+		atomic.AddInt32(&called, 1)
+		return nil, errors.New("not in db")
+	}
+	var out int
+	for i := 0; i < 3; i++ {
+		hit, err := e.Select(context.TODO(), "neg").Get("k1", nil, getter).Exec(&out)
+		if hit || err == nil || err.Error() != E_not_found {
+			log.Print(hit, err)
+			t.Fail()
+		}
+	}
+	if atomic.LoadInt32(&called) != 1 || e.Collection()["neg"].Stats().NegativeHits != 2 {
+		log.Print(called)
+		t.Fail()
+	}
+	if e.Collection()["neg"].IsKeyExisted("k1") {
+		t.Fail()
+	}
+
+	// tombstone expired, getters called again
+	time.Sleep(150 * time.Millisecond)
+	e.Select(context.TODO(), "neg").Get("k1", nil, getter).Exec(&out)
+	if atomic.LoadInt32(&called) != 2 {
+		t.Fail()
+	}
+
+	// upsert drop tombstone
+	e.Select(context.TODO(), "neg").Upsert("k1", 5)
+	hit, err := e.Select(context.TODO(), "neg").Get("k1", nil, getter).Exec(&out)
+	if !hit || err != nil || out != 5 {
+		log.Print(hit, err, out)
+		t.Fail()
+	}
+}
+
+func TestSessionSharedLoadCancel(t *testing.T) {
+	e := Start(&CollectionConfig{Key: "shared", Capacity: 10, ExpireDuration: 10 * time.Second})
+	defer e.Close(context.TODO())
+	release := make(chan struct{})
+	getter := func(ctx context.Context, collection string, key interface{}) (interface{}, error) {
+		select {
+		case <-release:
+			return 7, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		var out int
+		_, err := e.Select(ctx, "shared").GetWith("k1", nil, getter).Exec(&out)
+		firstErr <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	secondHit := make(chan int, 1)
+	go func() {
+		var out int
+		hit, err := e.Select(context.Background(), "shared").GetWith("k1", nil, getter).Exec(&out)
+		if !hit || err != nil {
+			log.Print(hit, err)
+			out = -1
+		}
+		secondHit <- out
+	}()
+	time.Sleep(20 * time.Millisecond)
+	// first caller gone, load still run for second caller
+	cancel()
+	if err := <-firstErr; err == nil || err.Error() != E_cancelled {
+		log.Print(err)
+		t.Fail()
+	}
+	close(release)
+	if out := <-secondHit; out != 7 {
+		log.Print(out)
+		t.Fail()
+	}
+}
+
+func TestSessionLoadTimeout(t *testing.T) {
+	e := Start(&CollectionConfig{Key: "loadtimeout", Capacity: 10, LoadTimeout: 30 * time.Millisecond})
+	defer e.Close(context.TODO())
+	type ctxKey struct{}
+	var deadline time.Time
+	var value interface{}
+	getter := func(ctx context.Context, collection string, key interface{}) (interface{}, error) {
+		deadline, _ = ctx.Deadline()
+		value = ctx.Value(ctxKey{})
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "v")
+	start := time.Now()
+	var out int
+	hit, _ := e.Select(ctx, "loadtimeout").GetWith(1, nil, getter).Exec(&out)
+	if hit || time.Since(start) > time.Second || deadline.Sub(start) > 100*time.Millisecond || value != "v" {
+		log.Print(hit, deadline.Sub(start), value)
+		t.Fail()
+	}
+}
+
+func TestSessionLoadFullCollection(t *testing.T) {
+	e := Start(&CollectionConfig{Key: "negfull", Capacity: 1, NegativeTTL: time.Minute})
+	defer e.Close(context.TODO())
+	for i := 0; i < 3; i++ {
+		i := i
+		getter := func(interface{}) (interface{}, error) {
+			return i, nil
+		}
+		var out int
+		// load evict other key, it's still a hit
+		hit, err := e.Select(context.TODO(), "negfull").Get(i, nil, getter).Exec(&out)
+		if !hit || err != nil || out != i {
+			log.Print(hit, err, out)
+			t.Fail()
+		}
+		typed, hit, err := SelectTyped[int, int](e, context.TODO(), "negfull").Get(i+10, func(k int) (int, error) { return k, nil }).Exec()
+		if !hit || err != nil || typed != i+10 {
+			log.Print(hit, err, typed)
+			t.Fail()
+		}
+	}
+}
+
+func TestSessionNegativeTTLRefreshFail(t *testing.T) {
+	loader := func(i interface{}) (interface{}, error) {
+		return nil, errors.New("db down")
+	}
+	e := Start(&CollectionConfig{
+		Key:            "negrefresh",
+		Capacity:       10,
+		ExpireDuration: 200 * time.Millisecond,
+		NegativeTTL:    time.Minute,
+		RefreshAhead:   0.9,
+		Loader:         []GetterFn{loader},
+	})
+	defer e.Close(context.TODO())
+	e.Select(context.TODO(), "negrefresh").Upsert("k1", 1)
+	time.Sleep(50 * time.Millisecond)
+	var out int
+	// read in refresh window, refresh fail in background
+	e.Select(context.TODO(), "negrefresh").Get("k1", nil).Exec(&out)
+	time.Sleep(50 * time.Millisecond)
+	hit, err := e.Select(context.TODO(), "negrefresh").Get("k1", nil).Exec(&out)
+	if !hit || err != nil || out != 1 {
+		log.Print(hit, err, out)
+		t.Fail()
+	}
+
+	// tombstone don't replace value upserted by other caller
+	col := e.Collection()["negrefresh"]
+	col.Upsert(context.TODO(), "k2", 2)
+	col.saveNegative("k2")
+	if val, has := col.Get(context.TODO(), "k2"); !has || val != 2 {
+		log.Print(val, has)
+		t.Fail()
+	}
+}
+
+func TestSessionGetWithCtx(t *testing.T) {
+	e := Start(&CollectionConfig{Key: "ctx", Capacity: 10, ExpireDuration: 10 * time.Second})
+	getter := func(ctx context.Context, collection string, key interface{}) (interface{}, error) {
+		if collection != "ctx" || key.(int) != 1 {
+			log.Print(collection, key)
+			t.Fail()
+		}
+		return 100, nil
+	}
+	var out int
+	hit, err := e.Select(context.TODO(), "ctx").GetWith(1, nil, getter).Exec(&out)
+	if !hit || err != nil || out != 100 {
+		log.Print(hit, err, out)
+		t.Fail()
+	}
+
+	// ctx done in first getter, chain stop
+	ctx, cancel := context.WithCancel(context.Background())
+	var called int32
+	slow := func(ctx context.Context, collection string, key interface{}) (interface{}, error) {
+		atomic.AddInt32(&called, 1)
+		cancel()
+		return nil, ctx.Err()
+	}
+	hit, err = e.Select(ctx, "ctx").GetWith(2, nil, slow, slow).Exec(&out)
+	if hit || err == nil || err.Error() != E_cancelled || atomic.LoadInt32(&called) != 1 {
+		log.Print(hit, err, called)
+		t.Fail()
+	}
+
+	var setted interface{}
+	setter := func(ctx context.Context, collection string, key, value interface{}) error {
+		setted = key
+		return nil
+	}
+	if err := e.Select(context.TODO(), "ctx").UpsertWith(3, 3, setter); err != nil || setted != 3 {
+		t.Fail()
+	}
+	if err := e.Select(ctx, "ctx").DeleteWith(3, setter); err == nil || err.Error() != E_cancelled {
+		log.Print(err)
+		t.Fail()
+	}
+}
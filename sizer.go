@@ -0,0 +1,103 @@
+package smartcache
+
+import "reflect"
+
+// Sizer return number of bytes a value take in memory
+type Sizer func(key, value interface{}) int64
+
+// mapEntryOverhead is bytes of a map entry besides key and value, roughly
+const mapEntryOverhead = 16
+
+/**
+DefaultSizer estimate bytes of key and value by walking them with reflect.
+Memory shared by pointers is counted once, unexported fields are counted too.
+It's an estimation, allocator and map buckets overhead are not exact.
+*/
+func DefaultSizer(key, value interface{}) int64 {
+	seen := make(map[uintptr]bool)
+	return deepSize(reflect.ValueOf(key), seen) + deepSize(reflect.ValueOf(value), seen)
+}
+
+func deepSize(v reflect.Value, seen map[uintptr]bool) int64 {
+	if !v.IsValid() {
+		return 0
+	}
+	return int64(v.Type().Size()) + indirectSize(v, seen)
+}
+
+// indirectSize is bytes v point to, not include v itself
+func indirectSize(v reflect.Value, seen map[uintptr]bool) int64 {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() || seen[v.Pointer()] {
+			return 0
+		}
+		seen[v.Pointer()] = true
+		return deepSize(v.Elem(), seen)
+	case reflect.Interface:
+		if v.IsNil() {
+			return 0
+		}
+		return deepSize(v.Elem(), seen)
+	case reflect.String:
+		return int64(v.Len())
+	case reflect.Slice:
+		if v.IsNil() || seen[v.Pointer()] {
+			return 0
+		}
+		seen[v.Pointer()] = true
+		elem := v.Type().Elem()
+		total := int64(v.Cap()) * int64(elem.Size())
+		if !hasPointers(elem) {
+			return total
+		}
+		for i := 0; i < v.Len(); i++ {
+			total += indirectSize(v.Index(i), seen)
+		}
+		return total
+	case reflect.Array:
+		if !hasPointers(v.Type().Elem()) {
+			return 0
+		}
+		var total int64
+		for i := 0; i < v.Len(); i++ {
+			total += indirectSize(v.Index(i), seen)
+		}
+		return total
+	case reflect.Map:
+		if v.IsNil() || seen[v.Pointer()] {
+			return 0
+		}
+		seen[v.Pointer()] = true
+		var total int64
+		iter := v.MapRange()
+		for iter.Next() {
+			total += mapEntryOverhead + deepSize(iter.Key(), seen) + deepSize(iter.Value(), seen)
+		}
+		return total
+	case reflect.Struct:
+		var total int64
+		for i := 0; i < v.NumField(); i++ {
+			total += indirectSize(v.Field(i), seen)
+		}
+		return total
+	}
+	return 0
+}
+
+// hasPointers tell values of t can point to other memory
+func hasPointers(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.String, reflect.Slice, reflect.Map:
+		return true
+	case reflect.Array:
+		return hasPointers(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if hasPointers(t.Field(i).Type) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package smartcache
+
+import (
+	"context"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+type sizedItem struct {
+	Name  string
+	Tags  []string
+	Attrs map[string]int
+	next  *sizedItem
+}
+
+func TestDefaultSizer(t *testing.T) {
+	small := DefaultSizer("k", 1)
+	big := DefaultSizer("k", strings.Repeat("a", 10000))
+	if small <= 0 || big < 10000 {
+		log.Print(small, big)
+		t.Fail()
+	}
+	item := &sizedItem{Name: strings.Repeat("n", 100), Tags: []string{"a", "b"}, Attrs: map[string]int{"x": 1}}
+	// cycle is counted once
+	item.next = item
+	size := DefaultSizer(nil, item)
+	log.Print(size)
+	if size < 100+2*16+2 || size > 1000 {
+		t.Fail()
+	}
+	if DefaultSizer(nil, []int64{1, 2, 3, 4}) < 32 {
+		t.Fail()
+	}
+}
+
+func TestCollectionMaxBytes(t *testing.T) {
+	sizer := func(key, value interface{}) int64 { return int64(len(value.(string))) }
+	e := Start(&CollectionConfig{Key: "bytes", Capacity: 100, ExpireDuration: 10 * time.Second, MaxBytes: 100, Sizer: sizer})
+	col := e.Collection()["bytes"]
+	for i := 0; i < 3; i++ {
+		if err := col.Upsert(context.TODO(), i, strings.Repeat("a", 30)); err != nil {
+			t.Fail()
+		}
+	}
+	if col.Stats().Bytes != 90 {
+		log.Print(col.Stats().Bytes)
+		t.Fail()
+	}
+	// 60 bytes more, two oldest evicted
+	if err := col.Upsert(context.TODO(), 3, strings.Repeat("b", 60)); err == nil || err.Error() != E_upsert_problem {
+		t.Fail()
+	}
+	stats := col.Stats()
+	if stats.Bytes != 90 || stats.Len != 2 || stats.Evictions != 2 || col.IsKeyExisted(0) || col.IsKeyExisted(1) {
+		log.Printf("%+v", stats)
+		t.Fail()
+	}
+	// replace value and delete update bytes
+	col.Upsert(context.TODO(), 3, "b")
+	col.Delete(context.TODO(), 2)
+	if col.Stats().Bytes != 1 {
+		log.Print(col.Stats().Bytes)
+		t.Fail()
+	}
+	// value bigger than MaxBytes is not kept, other items are not evicted for it
+	col.Upsert(context.TODO(), 5, "c")
+	before := col.Stats()
+	err := col.Upsert(context.TODO(), 5, strings.Repeat("c", 200))
+	after := col.Stats()
+	if err == nil || err.Error() != E_item_too_big || col.IsKeyExisted(5) || !col.IsKeyExisted(3) || after.Len != before.Len-1 || after.Evictions != before.Evictions || after.Bytes != 1 {
+		log.Print(err, before, after)
+		t.Fail()
+	}
+
+	if _, err := CreateCollection(&CollectionConfig{Key: "arc", MaxBytes: 100, Policy: PolicyARC}); err == nil {
+		t.Fail()
+	}
+}
@@ -0,0 +1,192 @@
+package smartcache
+
+import (
+	"bufio"
+	"encoding/gob"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const snapshotVersion = 1
+
+// Encoder write values to stream
+type Encoder interface {
+	Encode(v interface{}) error
+}
+
+// Decoder read values from stream
+type Decoder interface {
+	Decode(v interface{}) error
+}
+
+// Codec create encoder, decoder for snapshot
+type Codec interface {
+	NewEncoder(w io.Writer) Encoder
+	NewDecoder(r io.Reader) Decoder
+}
+
+/**
+GobCodec encode snapshot by encoding/gob.
+Keys and values saved as interface, so their types must be registered by RegisterType.
+*/
+type GobCodec struct{}
+
+func (GobCodec) NewEncoder(w io.Writer) Encoder {
+	return gob.NewEncoder(w)
+}
+
+func (GobCodec) NewDecoder(r io.Reader) Decoder {
+	return gob.NewDecoder(r)
+}
+
+// RegisterType register type of value to GobCodec
+func RegisterType(value interface{}) {
+	gob.Register(value)
+}
+
+type snapshotItem struct {
+	Key      interface{}
+	Value    interface{}
+	Created  int64
+	Deadline int64
+}
+
+type snapshotCollection struct {
+	Key   string
+	Items []*snapshotItem
+}
+
+type snapshot struct {
+	Version     int
+	Created     int64
+	Collections []*snapshotCollection
+}
+
+// snapshot copy items not expired from oldest to newest
+func (c *Collection) snapshot() *snapshotCollection {
+	out := &snapshotCollection{Key: c.key}
+	now := time.Now().UnixNano()
+	for _, key := range c.data.Keys() {
+		value, has := c.data.Peek(key)
+		if !has {
+			continue
+		}
+		colValue := value.(*CollectionValue)
+		if colValue.isExpired(now) || colValue.isNegative() {
+			continue
+		}
+		out.Items = append(out.Items, &snapshotItem{
+			Key:      key,
+			Value:    colValue.Value,
+			Created:  colValue.Created,
+			Deadline: colValue.Deadline,
+		})
+	}
+	return out
+}
+
+// restore add items of snapshot back, hooks are not fired. Return number of items restored
+func (c *Collection) restore(in *snapshotCollection) int {
+	count := 0
+	now := time.Now().UnixNano()
+	for _, item := range in.Items {
+		colValue := &CollectionValue{
+			Created:  item.Created,
+			Value:    item.Value,
+			Deadline: item.Deadline,
+		}
+		if colValue.isExpired(now) {
+			continue
+		}
+		// idle time count again from restore
+		colValue.touch(now, c.settings().idleTimeout)
+		c.data.Add(item.Key, colValue)
+		count++
+	}
+	return count
+}
+
+// SaveSnapshot write items of all collections to w by codec of engine
+func (e *Engine) SaveSnapshot(w io.Writer) error {
+	snap := &snapshot{Version: snapshotVersion, Created: time.Now().Unix()}
+	e.lock.RLock()
+	for _, col := range e.mCollection {
+		snap.Collections = append(snap.Collections, col.snapshot())
+	}
+	e.lock.RUnlock()
+	return e.codec.NewEncoder(w).Encode(snap)
+}
+
+// LoadSnapshot read snapshot from r, expired items and collections not in engine are skipped
+func (e *Engine) LoadSnapshot(r io.Reader) error {
+	snap := &snapshot{}
+	if err := e.codec.NewDecoder(r).Decode(snap); err != nil {
+		return err
+	}
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	for _, in := range snap.Collections {
+		col, has := e.mCollection[in.Key]
+		if !has {
+			log.Print("snapshot: skip collection not found ", in.Key)
+			continue
+		}
+		col.restore(in)
+	}
+	return nil
+}
+
+// SaveSnapshotFile write snapshot to a temp file then rename to path, so path is never half written
+func (e *Engine) SaveSnapshotFile(path string) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	w := bufio.NewWriter(f)
+	if err := e.SaveSnapshot(w); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func (e *Engine) LoadSnapshotFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return e.LoadSnapshot(bufio.NewReader(f))
+}
+
+/**
+WithSnapshotRestore restore snapshot file at path when Start, after all collections added.
+Missing file is fine, broken file is logged and engine start empty.
+*/
+func WithSnapshotRestore(path string) Option {
+	return optionFunc(func(e *Engine) error {
+		e.afterStart = append(e.afterStart, func() error {
+			err := e.LoadSnapshotFile(path)
+			if err != nil && !os.IsNotExist(err) {
+				log.Print("snapshot: restore fail ", path, " ", err)
+			}
+			return nil
+		})
+		return nil
+	})
+}
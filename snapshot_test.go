@@ -0,0 +1,82 @@
+package smartcache
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type snapshotUser struct {
+	Name string
+	Age  int
+}
+
+func TestSnapshotSaveLoad(t *testing.T) {
+	RegisterType(&snapshotUser{})
+	e := Start(
+		&CollectionConfig{Key: "users", Capacity: 10, ExpireDuration: 10 * time.Second},
+		&CollectionConfig{Key: "ints", Capacity: 10},
+	)
+	e.Select(context.TODO(), "users").Upsert("u1", &snapshotUser{"a", 10})
+	e.Select(context.TODO(), "users").UpsertTTL("u2", &snapshotUser{"b", 20}, 10*time.Millisecond)
+	e.Select(context.TODO(), "ints").Upsert(1, []int{1, 2, 3})
+	time.Sleep(20 * time.Millisecond)
+
+	buf := &bytes.Buffer{}
+	if err := e.SaveSnapshot(buf); err != nil {
+		log.Print(err)
+		t.Fail()
+	}
+
+	e2 := Start(&CollectionConfig{Key: "users", Capacity: 10, ExpireDuration: 10 * time.Second})
+	if err := e2.LoadSnapshot(buf); err != nil {
+		log.Print(err)
+		t.Fail()
+	}
+	if e2.Collection()["users"].Len() != 1 {
+		log.Print("expired item must skip")
+		t.Fail()
+	}
+	out := &snapshotUser{}
+	hit, _ := e2.Select(context.TODO(), "users").Get("u1", nil).Exec(out)
+	if !hit || out.Name != "a" || out.Age != 10 {
+		log.Print(out)
+		t.Fail()
+	}
+	before, _ := e.Collection()["users"].data.Peek("u1")
+	after, _ := e2.Collection()["users"].data.Peek("u1")
+	if before.(*CollectionValue).Created != after.(*CollectionValue).Created || before.(*CollectionValue).Deadline != after.(*CollectionValue).Deadline {
+		t.Fail()
+	}
+}
+
+func TestSnapshotFileRestoreOnStart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+	cf := func() *CollectionConfig {
+		return &CollectionConfig{Key: "col", Capacity: 10, ExpireDuration: 10 * time.Second}
+	}
+	// file not existed yet
+	e := StartWithOptions(cf(), WithSnapshotRestore(path))
+	e.Select(context.TODO(), "col").Upsert("k1", "v1")
+	if err := e.SaveSnapshotFile(path); err != nil {
+		log.Print(err)
+		t.Fail()
+	}
+	files, _ := os.ReadDir(filepath.Dir(path))
+	if len(files) != 1 {
+		log.Print("temp file is left")
+		t.Fail()
+	}
+
+	e2 := StartWithOptions(WithSnapshotRestore(path), cf())
+	var out string
+	hit, _ := e2.Select(context.TODO(), "col").Get("k1", nil).Exec(&out)
+	if !hit || out != "v1" {
+		log.Print(hit, out)
+		t.Fail()
+	}
+}
@@ -0,0 +1,233 @@
+package smartcache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// collectionStats is counters of a collection, all updated by atomic
+type collectionStats struct {
+	hits           uint64
+	misses         uint64
+	staleHits      uint64
+	negativeHits   uint64
+	loads          uint64
+	loadFailures   uint64
+	loadNanos      uint64
+	setterFailures uint64
+	expirations    uint64
+	evictions      uint64
+	refreshes      uint64
+	refreshDrops   uint64
+	loadRetries    uint64
+	setterRetries  uint64
+	// writesCoalesced is writes replaced a write of same key wait in write behind queue
+	writesCoalesced uint64
+	writeDrops      uint64
+	writeBatches    uint64
+	writeFailures   uint64
+	// loadBuckets count loads which took less or equal loadBucketBounds[i]
+	loadBuckets [len(loadBucketBounds)]uint64
+}
+
+// loadBucketBounds is upper bounds of load latency histogram
+var loadBucketBounds = [...]time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// CollectionStats is a snapshot of collection counters
+type CollectionStats struct {
+	Key             string        `json:"key"`
+	Len             int           `json:"len"`
+	Capacity        int           `json:"capacity"`
+	Bytes           int64         `json:"bytes"`
+	MaxBytes        int64         `json:"max_bytes"`
+	Hits            uint64        `json:"hits"`
+	Misses          uint64        `json:"misses"`
+	StaleHits       uint64        `json:"stale_hits"`
+	NegativeHits    uint64        `json:"negative_hits"`
+	Loads           uint64        `json:"loads"`
+	LoadFailures    uint64        `json:"load_failures"`
+	SetterFailures  uint64        `json:"setter_failures"`
+	Expirations     uint64        `json:"expirations"`
+	Evictions       uint64        `json:"evictions"`
+	Refreshes       uint64        `json:"refreshes"`
+	RefreshDrops    uint64        `json:"refresh_drops"`
+	LoadRetries     uint64        `json:"load_retries"`
+	SetterRetries   uint64        `json:"setter_retries"`
+	WriteQueued     int           `json:"write_queued"`
+	WritesCoalesced uint64        `json:"writes_coalesced"`
+	WriteDrops      uint64        `json:"write_drops"`
+	WriteBatches    uint64        `json:"write_batches"`
+	WriteFailures   uint64        `json:"write_failures"`
+	Coalesced       uint64        `json:"coalesced"`
+	HitRatio        float64       `json:"hit_ratio"`
+	AvgLoadLatency  time.Duration `json:"avg_load_latency"`
+}
+
+// EngineStats is stats of all collections in engine
+type EngineStats struct {
+	Collections map[string]CollectionStats `json:"collections"`
+	Circuits    map[string]CircuitStats    `json:"circuits"`
+}
+
+func (s *collectionStats) hit(has bool) {
+	if has {
+		atomic.AddUint64(&s.hits, 1)
+		return
+	}
+	atomic.AddUint64(&s.misses, 1)
+}
+
+// load count a getter call and how long it run
+func (s *collectionStats) load(err error, took time.Duration) {
+	atomic.AddUint64(&s.loadNanos, uint64(took))
+	for i, bound := range loadBucketBounds {
+		if took <= bound {
+			atomic.AddUint64(&s.loadBuckets[i], 1)
+			break
+		}
+	}
+	if err != nil {
+		atomic.AddUint64(&s.loadFailures, 1)
+		return
+	}
+	atomic.AddUint64(&s.loads, 1)
+}
+
+func (s *collectionStats) staleHit() {
+	atomic.AddUint64(&s.staleHits, 1)
+}
+
+func (s *collectionStats) negativeHit() {
+	atomic.AddUint64(&s.negativeHits, 1)
+}
+
+func (s *collectionStats) setterFailed() {
+	atomic.AddUint64(&s.setterFailures, 1)
+}
+
+func (s *collectionStats) expired() {
+	atomic.AddUint64(&s.expirations, 1)
+}
+
+func (s *collectionStats) evicted() {
+	atomic.AddUint64(&s.evictions, 1)
+}
+
+func (s *collectionStats) refreshed() {
+	atomic.AddUint64(&s.refreshes, 1)
+}
+
+func (s *collectionStats) refreshDropped() {
+	atomic.AddUint64(&s.refreshDrops, 1)
+}
+
+func (s *collectionStats) reset() {
+	atomic.StoreUint64(&s.hits, 0)
+	atomic.StoreUint64(&s.misses, 0)
+	atomic.StoreUint64(&s.staleHits, 0)
+	atomic.StoreUint64(&s.negativeHits, 0)
+	atomic.StoreUint64(&s.loads, 0)
+	atomic.StoreUint64(&s.loadFailures, 0)
+	atomic.StoreUint64(&s.loadNanos, 0)
+	atomic.StoreUint64(&s.setterFailures, 0)
+	atomic.StoreUint64(&s.expirations, 0)
+	atomic.StoreUint64(&s.evictions, 0)
+	atomic.StoreUint64(&s.refreshes, 0)
+	atomic.StoreUint64(&s.refreshDrops, 0)
+	atomic.StoreUint64(&s.loadRetries, 0)
+	atomic.StoreUint64(&s.setterRetries, 0)
+	atomic.StoreUint64(&s.writesCoalesced, 0)
+	atomic.StoreUint64(&s.writeDrops, 0)
+	atomic.StoreUint64(&s.writeBatches, 0)
+	atomic.StoreUint64(&s.writeFailures, 0)
+	for i := range s.loadBuckets {
+		atomic.StoreUint64(&s.loadBuckets[i], 0)
+	}
+}
+
+func (s *collectionStats) snapshot() CollectionStats {
+	out := CollectionStats{
+		Hits:            atomic.LoadUint64(&s.hits),
+		Misses:          atomic.LoadUint64(&s.misses),
+		StaleHits:       atomic.LoadUint64(&s.staleHits),
+		NegativeHits:    atomic.LoadUint64(&s.negativeHits),
+		Loads:           atomic.LoadUint64(&s.loads),
+		LoadFailures:    atomic.LoadUint64(&s.loadFailures),
+		SetterFailures:  atomic.LoadUint64(&s.setterFailures),
+		Expirations:     atomic.LoadUint64(&s.expirations),
+		Evictions:       atomic.LoadUint64(&s.evictions),
+		Refreshes:       atomic.LoadUint64(&s.refreshes),
+		RefreshDrops:    atomic.LoadUint64(&s.refreshDrops),
+		LoadRetries:     atomic.LoadUint64(&s.loadRetries),
+		SetterRetries:   atomic.LoadUint64(&s.setterRetries),
+		WritesCoalesced: atomic.LoadUint64(&s.writesCoalesced),
+		WriteDrops:      atomic.LoadUint64(&s.writeDrops),
+		WriteBatches:    atomic.LoadUint64(&s.writeBatches),
+		WriteFailures:   atomic.LoadUint64(&s.writeFailures),
+	}
+	if total := out.Hits + out.Misses; total > 0 {
+		out.HitRatio = float64(out.Hits) / float64(total)
+	}
+	if calls := out.Loads + out.LoadFailures; calls > 0 {
+		out.AvgLoadLatency = time.Duration(atomic.LoadUint64(&s.loadNanos) / calls)
+	}
+	return out
+}
+
+// Stats return counters of collection
+func (c *Collection) Stats() CollectionStats {
+	out := c.stats.snapshot()
+	out.Key = c.key
+	out.Len = c.Len()
+	out.Capacity = c.settings().capacity
+	out.Bytes = c.data.Bytes()
+	out.MaxBytes = c.maxBytes
+	out.Coalesced = c.Coalesced()
+	out.WriteQueued = c.writeQueued()
+	return out
+}
+
+// ResetStats set all counters of collection to 0
+func (c *Collection) ResetStats() {
+	c.stats.reset()
+	atomic.StoreUint64(&c.flight.coalesced, 0)
+}
+
+// Stats return stats of all collections
+func (e *Engine) Stats() EngineStats {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	out := EngineStats{
+		Collections: make(map[string]CollectionStats, len(e.mCollection)),
+		Circuits:    make(map[string]CircuitStats, len(e.circuits)),
+	}
+	for key, col := range e.mCollection {
+		out.Collections[key] = col.Stats()
+	}
+	for name, c := range e.circuits {
+		out.Circuits[name] = c.Stats()
+	}
+	return out
+}
+
+// ResetStats reset counters of all collections
+func (e *Engine) ResetStats() {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	for _, col := range e.mCollection {
+		col.ResetStats()
+	}
+}
@@ -0,0 +1,60 @@
+package smartcache
+
+import (
+	"context"
+	"errors"
+	"log"
+	"testing"
+	"time"
+)
+
+func TestCollectionStats(t *testing.T) {
+	e := Start(&CollectionConfig{Key: "stats", Capacity: 3, ExpireDuration: 10 * time.Second})
+	getter := func(i interface{}) (interface{}, error) {
+		time.Sleep(10 * time.Millisecond)
+		if i.(string) == "stats.k3" {
+			return []int{1, 2}, nil
+		}
+		return nil, errors.New("not found")
+	}
+	setter := func(k, v interface{}) error {
+		return errors.New("setter fail")
+	}
+	e.Select(context.TODO(), "stats").Upsert("k1", 1)
+	var out int
+	e.Select(context.TODO(), "stats").Get("k1", nil).Exec(&out)
+	e.Select(context.TODO(), "stats").Get("k2", nil).Exec(&out)
+	var list []int
+	e.Select(context.TODO(), "stats").Filter("k3", func(i interface{}, index int) bool { return true }, getter).Exec(&list)
+	e.Select(context.TODO(), "stats").Get("k4", nil, getter, getter).Exec(&out)
+	e.Select(context.TODO(), "stats").Upsert("k5", 5, setter)
+	e.Collection()["stats"].UpsertTTL(context.TODO(), "k6", 6, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	e.Collection()["stats"].Get(context.TODO(), "k6")
+
+	stats := e.Stats().Collections["stats"]
+	log.Printf("%+v", stats)
+	if stats.Hits != 1 || stats.Misses != 4 {
+		t.Fail()
+	}
+	if stats.Loads != 1 || stats.LoadFailures != 2 || stats.AvgLoadLatency < 10*time.Millisecond {
+		t.Fail()
+	}
+	if stats.SetterFailures != 1 || stats.Expirations != 1 {
+		t.Fail()
+	}
+	// k1 evicted by k6
+	if stats.Evictions != 1 || stats.Len != 2 || stats.Capacity != 3 {
+		t.Fail()
+	}
+	if stats.HitRatio != 0.2 {
+		t.Fail()
+	}
+
+	e.ResetStats()
+	stats = e.Collection()["stats"].Stats()
+	if stats.Hits != 0 || stats.Misses != 0 || stats.Loads != 0 || stats.HitRatio != 0 || stats.AvgLoadLatency != 0 {
+		log.Printf("%+v", stats)
+		t.Fail()
+	}
+}
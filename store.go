@@ -0,0 +1,372 @@
+package smartcache
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// store is where collection keep data, all method should safe for concurrent call
+type store interface {
+	Add(key, value interface{}) bool
+	// AddIf add value when key is not existed or replace(old value) is true, return true when value is added
+	AddIf(key, value interface{}, replace func(old interface{}) bool) bool
+	// Fits is false when value alone is bigger than max bytes of store, Add drop it and old value of key
+	Fits(key, value interface{}) bool
+	Get(key interface{}) (interface{}, bool)
+	Peek(key interface{}) (interface{}, bool)
+	Contains(key interface{}) bool
+	Remove(key interface{}) bool
+	Keys() []interface{}
+	Len() int
+	Resize(size int) int
+	Purge()
+	// Bytes is weight of all items, 0 when store has no weigh
+	Bytes() int64
+}
+
+// evictFn is called when item removed because store is full,
+// key and value are nil when policy can't tell item evicted (2Q, ARC)
+type evictFn func(key, value interface{})
+
+// weighFn return bytes of item in store
+type weighFn func(key, value interface{}) int64
+
+// storeConfig is limits of a store
+type storeConfig struct {
+	capacity int
+	policy   EvictionPolicy
+	// maxBytes is max weight of items, 0 is no limit
+	maxBytes int64
+	weigh    weighFn
+	onEvict  evictFn
+}
+
+// segment is a cache of eviction policy with own lock
+type segment struct {
+	lock     sync.Mutex
+	cache    policy
+	onEvict  evictFn
+	evicting bool
+	evicted  []*CollectionKV
+	weigh    weighFn
+	bytes    int64
+	maxBytes int64
+}
+
+func newSegment(cf storeConfig) (*segment, error) {
+	s := &segment{onEvict: cf.onEvict, weigh: cf.weigh, maxBytes: cf.maxBytes}
+	cache, err := newPolicy(cf.policy, cf.capacity, s.collectEvicted)
+	if err != nil {
+		return nil, err
+	}
+	s.cache = cache
+	return s, nil
+}
+
+// collectEvicted keep items removed by policy when Add or Resize,
+// items removed by Remove or Purge are not evicted
+func (s *segment) collectEvicted(key, value interface{}) {
+	if !s.evicting {
+		return
+	}
+	if s.weigh != nil {
+		s.bytes -= s.weigh(key, value)
+	}
+	if s.onEvict == nil {
+		return
+	}
+	s.evicted = append(s.evicted, &CollectionKV{Key: key, Value: value})
+}
+
+// fit evict items until bytes is under maxBytes, return true when any item evicted
+func (s *segment) fit() bool {
+	evicted := false
+	for s.maxBytes > 0 && s.bytes > s.maxBytes {
+		if _, _, ok := s.cache.RemoveOldest(); !ok {
+			break
+		}
+		evicted = true
+	}
+	return evicted
+}
+
+func (s *segment) Fits(key, value interface{}) bool {
+	return s.weigh == nil || s.maxBytes <= 0 || s.weigh(key, value) <= s.maxBytes
+}
+
+// fireEvicted call onEvict out of lock, so callback can use store
+func (s *segment) fireEvicted(evicted []*CollectionKV) {
+	for _, item := range evicted {
+		s.onEvict(item.Key, item.Value)
+	}
+}
+
+func (s *segment) Add(key, value interface{}) bool {
+	s.lock.Lock()
+	ok, evicted := s.addLocked(key, value)
+	s.lock.Unlock()
+	s.fireEvicted(evicted)
+	return ok
+}
+
+// AddIf check old value and add under same lock, so other Add can't run between them
+func (s *segment) AddIf(key, value interface{}, replace func(old interface{}) bool) bool {
+	s.lock.Lock()
+	if old, has := s.cache.Peek(key); has && !replace(old) {
+		s.lock.Unlock()
+		return false
+	}
+	_, evicted := s.addLocked(key, value)
+	s.lock.Unlock()
+	s.fireEvicted(evicted)
+	return true
+}
+
+// addLocked add value and return items evicted, caller hold lock and fire them after unlock
+func (s *segment) addLocked(key, value interface{}) (bool, []*CollectionKV) {
+	if !s.Fits(key, value) {
+		// evict others can't make room for it
+		s.removeLocked(key)
+		return false, nil
+	}
+	s.evicting = true
+	if s.weigh != nil {
+		if old, has := s.cache.Peek(key); has {
+			s.bytes -= s.weigh(key, old)
+		}
+		s.bytes += s.weigh(key, value)
+	}
+	ok := s.cache.Add(key, value)
+	ok = s.fit() || ok
+	s.evicting = false
+	evicted := s.evicted
+	s.evicted = nil
+	if ok && len(evicted) == 0 && s.onEvict != nil {
+		evicted = append(evicted, &CollectionKV{})
+	}
+	return ok, evicted
+}
+
+func (s *segment) Get(key interface{}) (interface{}, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.cache.Get(key)
+}
+
+func (s *segment) Peek(key interface{}) (interface{}, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.cache.Peek(key)
+}
+
+func (s *segment) Contains(key interface{}) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.cache.Contains(key)
+}
+
+func (s *segment) Remove(key interface{}) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.removeLocked(key)
+}
+
+func (s *segment) removeLocked(key interface{}) bool {
+	if s.weigh != nil {
+		if old, has := s.cache.Peek(key); has {
+			s.bytes -= s.weigh(key, old)
+		}
+	}
+	return s.cache.Remove(key)
+}
+
+func (s *segment) Keys() []interface{} {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.cache.Keys()
+}
+
+func (s *segment) Len() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.cache.Len()
+}
+
+func (s *segment) Resize(size int) int {
+	s.lock.Lock()
+	s.evicting = true
+	n := s.cache.Resize(size)
+	s.evicting = false
+	evicted := s.evicted
+	s.evicted = nil
+	s.lock.Unlock()
+	s.fireEvicted(evicted)
+	return n
+}
+
+func (s *segment) Purge() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.cache.Purge()
+	s.bytes = 0
+}
+
+func (s *segment) Bytes() int64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.bytes
+}
+
+/**
+shardedStore split keys to many segments by hash of key.
+Each segment has own lock, so goroutines work on different segment don't wait each other.
+Capacity and MaxBytes are divided equally for segments.
+*/
+type shardedStore struct {
+	shards []*segment
+}
+
+func newShardedStore(cf storeConfig, shards int) (*shardedStore, error) {
+	s := &shardedStore{shards: make([]*segment, shards)}
+	cf.capacity = shardSize(cf.capacity, shards)
+	if cf.maxBytes > 0 {
+		cf.maxBytes = (cf.maxBytes + int64(shards) - 1) / int64(shards)
+	}
+	for i := range s.shards {
+		seg, err := newSegment(cf)
+		if err != nil {
+			return nil, err
+		}
+		s.shards[i] = seg
+	}
+	return s, nil
+}
+
+func shardSize(capacity, shards int) int {
+	size := capacity / shards
+	if capacity%shards != 0 {
+		size++
+	}
+	return size
+}
+
+func (s *shardedStore) shard(key interface{}) *segment {
+	return s.shards[hashKey(key)%uint64(len(s.shards))]
+}
+
+func (s *shardedStore) Add(key, value interface{}) bool {
+	return s.shard(key).Add(key, value)
+}
+
+func (s *shardedStore) AddIf(key, value interface{}, replace func(old interface{}) bool) bool {
+	return s.shard(key).AddIf(key, value, replace)
+}
+
+func (s *shardedStore) Fits(key, value interface{}) bool {
+	return s.shard(key).Fits(key, value)
+}
+
+func (s *shardedStore) Get(key interface{}) (interface{}, bool) {
+	return s.shard(key).Get(key)
+}
+
+func (s *shardedStore) Peek(key interface{}) (interface{}, bool) {
+	return s.shard(key).Peek(key)
+}
+
+func (s *shardedStore) Contains(key interface{}) bool {
+	return s.shard(key).Contains(key)
+}
+
+func (s *shardedStore) Remove(key interface{}) bool {
+	return s.shard(key).Remove(key)
+}
+
+func (s *shardedStore) Keys() []interface{} {
+	keys := make([]interface{}, 0, s.Len())
+	for _, seg := range s.shards {
+		keys = append(keys, seg.Keys()...)
+	}
+	return keys
+}
+
+func (s *shardedStore) Len() int {
+	total := 0
+	for _, seg := range s.shards {
+		total += seg.Len()
+	}
+	return total
+}
+
+func (s *shardedStore) Resize(size int) int {
+	evicted := 0
+	for _, seg := range s.shards {
+		evicted += seg.Resize(shardSize(size, len(s.shards)))
+	}
+	return evicted
+}
+
+func (s *shardedStore) Purge() {
+	for _, seg := range s.shards {
+		seg.Purge()
+	}
+}
+
+func (s *shardedStore) Bytes() int64 {
+	var total int64
+	for _, seg := range s.shards {
+		total += seg.Bytes()
+	}
+	return total
+}
+
+const (
+	fnvOffset64 = 14695981039346656037
+	fnvPrime64  = 1099511628211
+)
+
+// hashKey hash key to choose segment, common types hashed without allocation
+func hashKey(key interface{}) uint64 {
+	switch k := key.(type) {
+	case string:
+		return hashString(k)
+	case int:
+		return mixInt(uint64(k))
+	case int64:
+		return mixInt(uint64(k))
+	case int32:
+		return mixInt(uint64(k))
+	case uint:
+		return mixInt(uint64(k))
+	case uint64:
+		return mixInt(k)
+	case uint32:
+		return mixInt(uint64(k))
+	}
+	// pointer key is compared by address, so it's hashed by address not by value it point to
+	switch v := reflect.ValueOf(key); v.Kind() {
+	case reflect.Ptr, reflect.Chan, reflect.UnsafePointer:
+		return mixInt(uint64(v.Pointer()))
+	}
+	return hashString(fmt.Sprintf("%T.%v", key, key))
+}
+
+func hashString(s string) uint64 {
+	h := uint64(fnvOffset64)
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= fnvPrime64
+	}
+	return h
+}
+
+// mixInt spread near numbers to different segments
+func mixInt(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
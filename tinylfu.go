@@ -0,0 +1,277 @@
+package smartcache
+
+import (
+	"container/list"
+
+	"github.com/hashicorp/golang-lru/simplelru"
+)
+
+const (
+	sketchDepth   = 4
+	sketchMax     = 15
+	sketchSeedMix = 0x9e3779b97f4a7c15
+)
+
+/**
+cmSketch is count-min sketch estimate how many times a key is used recently.
+Counters are halved after 10 * size increments, so old popularity fade out.
+*/
+type cmSketch struct {
+	rows      [sketchDepth][]uint8
+	mask      uint64
+	additions int
+	resetAt   int
+}
+
+func newCMSketch(size int) *cmSketch {
+	width := 16
+	for width < size {
+		width <<= 1
+	}
+	s := &cmSketch{mask: uint64(width - 1), resetAt: 10 * size}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+func (s *cmSketch) index(h uint64, row int) uint64 {
+	return mixInt(h+uint64(row)*sketchSeedMix) & s.mask
+}
+
+func (s *cmSketch) increment(key interface{}) {
+	h := hashKey(key)
+	for i := range s.rows {
+		if idx := s.index(h, i); s.rows[i][idx] < sketchMax {
+			s.rows[i][idx]++
+		}
+	}
+	s.additions++
+	if s.additions >= s.resetAt {
+		for i := range s.rows {
+			for j := range s.rows[i] {
+				s.rows[i][j] >>= 1
+			}
+		}
+		s.additions /= 2
+	}
+}
+
+func (s *cmSketch) estimate(key interface{}) uint8 {
+	h := hashKey(key)
+	min := uint8(sketchMax)
+	for i := range s.rows {
+		if v := s.rows[i][s.index(h, i)]; v < min {
+			min = v
+		}
+	}
+	return min
+}
+
+const (
+	tinyWindow = iota
+	tinyProbation
+	tinyProtected
+)
+
+type tinyEntry struct {
+	key   interface{}
+	value interface{}
+	where int
+	elem  *list.Element
+}
+
+/**
+tinyLFU is W-TinyLFU: new items go to a small LRU window (1% of size),
+item leave window enter main segmented LRU only when it's used more often than
+the item main would evict. Items used again in probation move to protected (80% of main).
+*/
+type tinyLFU struct {
+	size        int
+	windowSize  int
+	protectSize int
+	items       map[interface{}]*tinyEntry
+	lists       [3]*list.List
+	sketch      *cmSketch
+	onEvict     simplelru.EvictCallback
+}
+
+func newTinyLFU(size int, onEvict simplelru.EvictCallback) *tinyLFU {
+	c := &tinyLFU{
+		items:   make(map[interface{}]*tinyEntry),
+		sketch:  newCMSketch(size),
+		onEvict: onEvict,
+	}
+	for i := range c.lists {
+		c.lists[i] = list.New()
+	}
+	c.setSize(size)
+	return c
+}
+
+func (c *tinyLFU) setSize(size int) {
+	c.size = size
+	c.windowSize = size / 100
+	if c.windowSize < 1 {
+		c.windowSize = 1
+	}
+	c.protectSize = (size - c.windowSize) * 8 / 10
+}
+
+func (c *tinyLFU) move(e *tinyEntry, where int) {
+	c.lists[e.where].Remove(e.elem)
+	e.where = where
+	e.elem = c.lists[where].PushFront(e)
+}
+
+func (c *tinyLFU) drop(e *tinyEntry) {
+	c.lists[e.where].Remove(e.elem)
+	delete(c.items, e.key)
+	if c.onEvict != nil {
+		c.onEvict(e.key, e.value)
+	}
+}
+
+func (c *tinyLFU) back(where int) *tinyEntry {
+	if el := c.lists[where].Back(); el != nil {
+		return el.Value.(*tinyEntry)
+	}
+	return nil
+}
+
+// use move item to front, item of probation is promoted to protected
+func (c *tinyLFU) use(e *tinyEntry) {
+	switch e.where {
+	case tinyWindow, tinyProtected:
+		c.lists[e.where].MoveToFront(e.elem)
+	case tinyProbation:
+		c.move(e, tinyProtected)
+		for c.lists[tinyProtected].Len() > c.protectSize {
+			c.move(c.back(tinyProtected), tinyProbation)
+		}
+	}
+}
+
+// admit move items over window size to main, return number of items evicted
+func (c *tinyLFU) admit() int {
+	evicted := 0
+	for c.lists[tinyWindow].Len() > c.windowSize {
+		candidate := c.back(tinyWindow)
+		if len(c.items) <= c.size {
+			c.move(candidate, tinyProbation)
+			continue
+		}
+		victim := c.back(tinyProbation)
+		if victim == nil {
+			victim = c.back(tinyProtected)
+		}
+		if victim != nil && c.sketch.estimate(candidate.key) > c.sketch.estimate(victim.key) {
+			c.drop(victim)
+			c.move(candidate, tinyProbation)
+		} else {
+			c.drop(candidate)
+		}
+		evicted++
+	}
+	return evicted
+}
+
+func (c *tinyLFU) Add(key, value interface{}) bool {
+	c.sketch.increment(key)
+	if e, has := c.items[key]; has {
+		e.value = value
+		c.use(e)
+		return false
+	}
+	e := &tinyEntry{key: key, value: value, where: tinyWindow}
+	e.elem = c.lists[tinyWindow].PushFront(e)
+	c.items[key] = e
+	return c.admit() > 0
+}
+
+func (c *tinyLFU) Get(key interface{}) (interface{}, bool) {
+	c.sketch.increment(key)
+	e, has := c.items[key]
+	if !has {
+		return nil, false
+	}
+	c.use(e)
+	return e.value, true
+}
+
+func (c *tinyLFU) Peek(key interface{}) (interface{}, bool) {
+	e, has := c.items[key]
+	if !has {
+		return nil, false
+	}
+	return e.value, true
+}
+
+func (c *tinyLFU) Contains(key interface{}) bool {
+	_, has := c.items[key]
+	return has
+}
+
+func (c *tinyLFU) Remove(key interface{}) bool {
+	e, has := c.items[key]
+	if !has {
+		return false
+	}
+	c.lists[e.where].Remove(e.elem)
+	delete(c.items, key)
+	return true
+}
+
+// Keys return keys of probation, protected then window, each from oldest to newest
+func (c *tinyLFU) Keys() []interface{} {
+	keys := make([]interface{}, 0, len(c.items))
+	for _, where := range []int{tinyProbation, tinyProtected, tinyWindow} {
+		for el := c.lists[where].Back(); el != nil; el = el.Prev() {
+			keys = append(keys, el.Value.(*tinyEntry).key)
+		}
+	}
+	return keys
+}
+
+func (c *tinyLFU) Len() int {
+	return len(c.items)
+}
+
+func (c *tinyLFU) Resize(size int) int {
+	c.setSize(size)
+	evicted := 0
+	for len(c.items) > size {
+		c.RemoveOldest()
+		evicted++
+	}
+	for c.lists[tinyProtected].Len() > c.protectSize {
+		c.move(c.back(tinyProtected), tinyProbation)
+	}
+	for c.lists[tinyWindow].Len() > c.windowSize {
+		c.move(c.back(tinyWindow), tinyProbation)
+	}
+	return evicted
+}
+
+// RemoveOldest evict oldest item of probation, then of protected, then of window
+func (c *tinyLFU) RemoveOldest() (interface{}, interface{}, bool) {
+	for _, where := range []int{tinyProbation, tinyProtected, tinyWindow} {
+		if victim := c.back(where); victim != nil {
+			c.drop(victim)
+			return victim.key, victim.value, true
+		}
+	}
+	return nil, nil, false
+}
+
+func (c *tinyLFU) Purge() {
+	for key, e := range c.items {
+		if c.onEvict != nil {
+			c.onEvict(key, e.value)
+		}
+	}
+	c.items = make(map[interface{}]*tinyEntry)
+	for i := range c.lists {
+		c.lists[i].Init()
+	}
+}
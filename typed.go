@@ -0,0 +1,393 @@
+package smartcache
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// TypedGetterFn load value of key when collection don't have it
+type TypedGetterFn[K comparable, V any] func(key K) (V, error)
+
+// TypedSetterFn write value of key to other storage
+type TypedSetterFn[K comparable, V any] func(key K, value V) error
+
+// TypedCtxGetterFn is TypedGetterFn receive ctx, it's done when load should stop
+type TypedCtxGetterFn[K comparable, V any] func(ctx context.Context, key K) (V, error)
+
+// TypedCtxSetterFn is TypedSetterFn receive ctx of session
+type TypedCtxSetterFn[K comparable, V any] func(ctx context.Context, key K, value V) error
+
+// typedCtxGetters wrap getters to TypedCtxGetterFn
+func typedCtxGetters[K comparable, V any](getterFns []TypedGetterFn[K, V]) []TypedCtxGetterFn[K, V] {
+	out := make([]TypedCtxGetterFn[K, V], 0, len(getterFns))
+	for _, f := range getterFns {
+		f := f
+		out = append(out, func(ctx context.Context, key K) (V, error) {
+			return f(key)
+		})
+	}
+	return out
+}
+
+// typedCtxSetters wrap setters to TypedCtxSetterFn
+func typedCtxSetters[K comparable, V any](setterFns []TypedSetterFn[K, V]) []TypedCtxSetterFn[K, V] {
+	out := make([]TypedCtxSetterFn[K, V], 0, len(setterFns))
+	for _, f := range setterFns {
+		f := f
+		out = append(out, func(ctx context.Context, key K, value V) error {
+			return f(key, value)
+		})
+	}
+	return out
+}
+
+/**
+TypedCollection is a Collection with fixed type of key and value.
+Value saved as it is, so read don't need reflect or json to convert.
+*/
+type TypedCollection[K comparable, V any] struct {
+	col *Collection
+}
+
+func CreateTypedCollection[K comparable, V any](config *CollectionConfig) (*TypedCollection[K, V], error) {
+	col, err := CreateCollection(config)
+	if err != nil {
+		return nil, err
+	}
+	return Typed[K, V](col), nil
+}
+
+// Typed wrap a collection, collection should only save key K and value V
+func Typed[K comparable, V any](col *Collection) *TypedCollection[K, V] {
+	return &TypedCollection[K, V]{col: col}
+}
+
+func (c *TypedCollection[K, V]) Collection() *Collection {
+	return c.col
+}
+
+func (c *TypedCollection[K, V]) Key() string {
+	return c.col.Key()
+}
+
+func (c *TypedCollection[K, V]) Len() int {
+	return c.col.Len()
+}
+
+func (c *TypedCollection[K, V]) IsKeyExisted(key K) bool {
+	return c.col.IsKeyExisted(key)
+}
+
+func (c *TypedCollection[K, V]) GC() error {
+	return c.col.GC()
+}
+
+func (c *TypedCollection[K, V]) Upsert(ctx context.Context, key K, value V) error {
+	return c.col.Upsert(ctx, key, value)
+}
+
+func (c *TypedCollection[K, V]) UpsertTTL(ctx context.Context, key K, value V, ttl time.Duration) error {
+	return c.col.UpsertTTL(ctx, key, value, ttl)
+}
+
+func (c *TypedCollection[K, V]) Delete(ctx context.Context, key K) error {
+	return c.col.Delete(ctx, key)
+}
+
+func (c *TypedCollection[K, V]) Get(ctx context.Context, key K) (V, bool) {
+	var zero V
+	val, has := c.col.Get(ctx, key)
+	if !has {
+		return zero, false
+	}
+	out, ok := val.(V)
+	if !ok {
+		return zero, false
+	}
+	return out, true
+}
+
+func (c *TypedCollection[K, V]) Session(ctx context.Context) *TypedSession[K, V] {
+	return createTypedSession(ctx, c, nil)
+}
+
+/**
+TypedSession is Session for TypedCollection.
+Exec return value with type V directly.
+*/
+type TypedSession[K comparable, V any] struct {
+	ctx        context.Context
+	collection *TypedCollection[K, V]
+	out        V
+	hit        bool
+	stale      bool
+	err        error
+}
+
+// SelectTyped select collection of engine as TypedCollection
+func SelectTyped[K comparable, V any](e *Engine, ctx context.Context, collectionKey string) *TypedSession[K, V] {
+	if e.IsClosed() {
+		return createTypedSession[K, V](ctx, nil, errors.New(E_engine_closed))
+	}
+	e.lock.RLock()
+	col, has := e.mCollection[collectionKey]
+	e.lock.RUnlock()
+	if !has {
+		return createTypedSession[K, V](ctx, nil, errors.New(E_not_found_any_collection_key))
+	}
+	return createTypedSession(ctx, Typed[K, V](col), nil)
+}
+
+func createTypedSession[K comparable, V any](ctx context.Context, col *TypedCollection[K, V], err error) *TypedSession[K, V] {
+	if ctx == nil {
+		ctx = context.TODO()
+	}
+	return &TypedSession[K, V]{
+		ctx:        ctx,
+		collection: col,
+		err:        err,
+	}
+}
+
+func (s *TypedSession[K, V]) Close() {
+	var zero V
+	s.out = zero
+	s.hit = false
+	s.stale = false
+	s.err = nil
+	s.ctx = nil
+}
+
+// context return ctx of session, session reused after Exec has no ctx
+func (s *TypedSession[K, V]) context() context.Context {
+	if s.ctx == nil {
+		return context.TODO()
+	}
+	return s.ctx
+}
+
+// load get value from collection, when not existed run getters to fill it
+func (s *TypedSession[K, V]) load(key K, getterFns []TypedCtxGetterFn[K, V]) (V, bool) {
+	var zero V
+	col := s.collection.col
+	colValue, stale, has := col.lookupStale(key)
+	if has && colValue.isNegative() {
+		col.stats.negativeHit()
+		s.err = errors.New(E_not_found)
+		return zero, false
+	}
+	if has && (!stale || len(getterFns) > 0) {
+		out, ok := colValue.Value.(V)
+		col.stats.hit(ok)
+		if ok && stale {
+			s.stale = true
+			col.stats.staleHit()
+			col.revalidate(key, func(ctx context.Context) func() (interface{}, error) {
+				return s.loadFn(ctx, key, getterFns, false)
+			})
+		}
+		if ok {
+			return out, true
+		}
+	} else {
+		col.stats.hit(false)
+	}
+	if len(getterFns) == 0 {
+		return zero, false
+	}
+	val, err := col.loadShared(s.context(), key, func(ctx context.Context) func() (interface{}, error) {
+		return s.loadFn(ctx, key, getterFns, true)
+	})
+	if err != nil {
+		switch {
+		case s.context().Err() != nil:
+			s.err = errors.New(E_cancelled)
+		case err.Error() != E_cancelled && col.settings().negativeTTL > 0:
+			s.err = errors.New(E_not_found)
+		}
+		return zero, false
+	}
+	out, ok := val.(V)
+	return out, ok
+}
+
+// loadFn return function run getters one by one, first value found is saved to collection.
+// Chain stop when ctx is done. Key not found is remembered only when remember is true, like Collection.loadFn
+func (s *TypedSession[K, V]) loadFn(ctx context.Context, key K, getterFns []TypedCtxGetterFn[K, V], remember bool) func() (interface{}, error) {
+	col := s.collection.col
+	return func() (interface{}, error) {
+		if val, has := col.get(key); has {
+			if _, ok := val.(V); ok {
+				return val, nil
+			}
+		}
+		skipped := false
+		for _, f := range getterFns {
+			if ctx.Err() != nil {
+				return nil, errors.New(E_cancelled)
+			}
+			start := time.Now()
+			var val V
+			err := col.retry.do(ctx, &col.stats.loadRetries, func() (err error) {
+				val, err = f(ctx, key)
+				return err
+			})
+			if isCircuitOpen(err) {
+				skipped = true
+				continue
+			}
+			col.stats.load(err, time.Since(start))
+			if err != nil {
+				continue
+			}
+			// evicting other items or value too big to cache don't make load failed
+			col.upsert(key, val, 0, ReasonLoad)
+			return val, nil
+		}
+		if ctx.Err() != nil {
+			return nil, errors.New(E_cancelled)
+		}
+		if remember && !skipped {
+			col.saveNegative(key)
+		}
+		return nil, errors.New(E_no_item_to_get)
+	}
+}
+
+func (s *TypedSession[K, V]) Get(key K, getterFns ...TypedGetterFn[K, V]) *TypedSession[K, V] {
+	return s.GetWith(key, typedCtxGetters(getterFns)...)
+}
+
+// GetWith is Get with getters receive ctx, it work like ctx of Session.GetWith
+func (s *TypedSession[K, V]) GetWith(key K, getterFns ...TypedCtxGetterFn[K, V]) *TypedSession[K, V] {
+	if s.err != nil {
+		return s
+	}
+	s.out, s.hit = s.load(key, getterFns)
+	return s
+}
+
+// FilterSlice keep items of slice saved in key which iter return true
+func FilterSlice[K comparable, E any](s *TypedSession[K, []E], key K, iter func(item E, index int) bool, getterFns ...TypedGetterFn[K, []E]) *TypedSession[K, []E] {
+	return FilterSliceWith(s, key, iter, typedCtxGetters(getterFns)...)
+}
+
+// FilterSliceWith is FilterSlice with getters receive ctx
+func FilterSliceWith[K comparable, E any](s *TypedSession[K, []E], key K, iter func(item E, index int) bool, getterFns ...TypedCtxGetterFn[K, []E]) *TypedSession[K, []E] {
+	if s.err != nil {
+		return s
+	}
+	items, has := s.load(key, getterFns)
+	if !has {
+		return s
+	}
+	out := make([]E, 0, 10)
+	for i, item := range items {
+		if iter(item, i) {
+			out = append(out, item)
+		}
+	}
+	s.out, s.hit = out, true
+	return s
+}
+
+// Exec return value of Get or FilterSlice, session closed after that
+func (s *TypedSession[K, V]) Exec() (V, bool, error) {
+	defer s.Close()
+	var zero V
+	if s.err != nil {
+		return zero, false, s.err
+	}
+	if !s.hit {
+		return zero, false, errors.New(E_no_item_to_get)
+	}
+	return s.out, true, nil
+}
+
+// ExecStale is Exec and also tell value is stale, it's being refreshed in background
+func (s *TypedSession[K, V]) ExecStale() (V, bool, bool, error) {
+	stale := s.stale
+	out, hit, err := s.Exec()
+	return out, hit, stale && hit, err
+}
+
+func (s *TypedSession[K, V]) Upsert(key K, value V, setterFns ...TypedSetterFn[K, V]) error {
+	return s.UpsertTTLWith(key, value, 0, typedCtxSetters(setterFns)...)
+}
+
+// UpsertTTL upsert value live in ttl, ttl 0 use ExpireDuration of collection
+func (s *TypedSession[K, V]) UpsertTTL(key K, value V, ttl time.Duration, setterFns ...TypedSetterFn[K, V]) error {
+	return s.UpsertTTLWith(key, value, ttl, typedCtxSetters(setterFns)...)
+}
+
+// UpsertWith is Upsert with setters receive ctx of session
+func (s *TypedSession[K, V]) UpsertWith(key K, value V, setterFns ...TypedCtxSetterFn[K, V]) error {
+	return s.UpsertTTLWith(key, value, 0, setterFns...)
+}
+
+// UpsertTTLWith is UpsertTTL with setters receive ctx of session
+func (s *TypedSession[K, V]) UpsertTTLWith(key K, value V, ttl time.Duration, setterFns ...TypedCtxSetterFn[K, V]) error {
+	if s.err != nil {
+		return s.err
+	}
+	if s.collection.col.writeThrough && len(setterFns) > 0 {
+		if err := s.set(key, value, setterFns); err != nil {
+			return err
+		}
+		return s.collection.UpsertTTL(s.ctx, key, value, ttl)
+	}
+	if err := s.collection.UpsertTTL(s.ctx, key, value, ttl); err != nil {
+		return err
+	}
+	return s.set(key, value, setterFns)
+}
+
+// set run setters with retry policy of collection, it stop when ctx is done and return E_cancelled.
+// Setters failed are returned by *SetterError
+func (s *TypedSession[K, V]) set(key K, value V, setterFns []TypedCtxSetterFn[K, V]) error {
+	col := s.collection.col
+	ctx := s.context()
+	serr := &SetterError{Collection: col.key, Key: key, CacheChanged: !col.writeThrough}
+	for i, f := range setterFns {
+		if ctx.Err() != nil {
+			return errors.New(E_cancelled)
+		}
+		err := col.retry.do(ctx, &col.stats.setterRetries, func() error {
+			return f(ctx, key, value)
+		})
+		if err != nil && err.Error() == E_cancelled {
+			return err
+		}
+		if err != nil {
+			col.stats.setterFailed()
+			serr.add(i, err)
+		}
+	}
+	if len(serr.Failures) > 0 {
+		return serr
+	}
+	return nil
+}
+
+func (s *TypedSession[K, V]) Delete(key K, setterFns ...TypedSetterFn[K, V]) error {
+	return s.DeleteWith(key, typedCtxSetters(setterFns)...)
+}
+
+// DeleteWith is Delete with setters receive ctx of session
+func (s *TypedSession[K, V]) DeleteWith(key K, setterFns ...TypedCtxSetterFn[K, V]) error {
+	if s.err != nil {
+		return s.err
+	}
+	var zero V
+	if s.collection.col.writeThrough && len(setterFns) > 0 {
+		if err := s.set(key, zero, setterFns); err != nil {
+			return err
+		}
+		return s.collection.Delete(s.ctx, key)
+	}
+	if err := s.collection.Delete(s.ctx, key); err != nil {
+		return err
+	}
+	return s.set(key, zero, setterFns)
+}
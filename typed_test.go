@@ -0,0 +1,157 @@
+package smartcache
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTypedCollection(t *testing.T) {
+	col, err := CreateTypedCollection[string, *D](&CollectionConfig{Key: "typed", Capacity: 10, ExpireDuration: 2 * time.Second})
+	if err != nil {
+		log.Print(err)
+		t.Fail()
+	}
+	if err := col.Upsert(context.TODO(), "k1", &D{"a"}); err != nil {
+		log.Print(err)
+		t.Fail()
+	}
+	out, has := col.Get(context.TODO(), "k1")
+	if !has || out.a != "a" {
+		log.Print(out, has)
+		t.Fail()
+	}
+	// value with other type is not hit
+	col.Collection().Upsert(context.TODO(), "k2", 10)
+	if _, has := col.Get(context.TODO(), "k2"); has {
+		t.Fail()
+	}
+}
+
+func TestTypedSession(t *testing.T) {
+	e := Start(&CollectionConfig{Key: "ints", Capacity: 100, ExpireDuration: 10 * time.Second})
+
+	if err := SelectTyped[int, []int](e, context.TODO(), "ints").Upsert(1, []int{1, 2, 3, 4}); err != nil {
+		log.Print(err)
+		t.Fail()
+	}
+	out, hit, err := SelectTyped[int, []int](e, context.TODO(), "ints").Get(1).Exec()
+	if !hit || err != nil || len(out) != 4 {
+		log.Print(out, hit, err)
+		t.Fail()
+	}
+
+	out, hit, _ = FilterSlice(SelectTyped[int, []int](e, context.TODO(), "ints"), 1, func(item int, index int) bool {
+		return item >= 3
+	}).Exec()
+	if !hit || len(out) != 2 || out[0] != 3 {
+		log.Print(out, hit)
+		t.Fail()
+	}
+
+	called := 0
+	getter := func(key int) ([]int, error) {
+		called++
+		if key == 2 {
+			return []int{5, 6}, nil
+		}
+		return nil, errors.New("not found")
+	}
+	out, hit, _ = SelectTyped[int, []int](e, context.TODO(), "ints").Get(2, getter).Exec()
+	if !hit || len(out) != 2 || called != 1 {
+		log.Print(out, hit, called)
+		t.Fail()
+	}
+	// second read from cache
+	SelectTyped[int, []int](e, context.TODO(), "ints").Get(2, getter).Exec()
+	if called != 1 {
+		t.Fail()
+	}
+
+	_, hit, err = SelectTyped[int, []int](e, context.TODO(), "ints").Get(3, getter).Exec()
+	if hit || err == nil || err.Error() != E_no_item_to_get {
+		log.Print(hit, err)
+		t.Fail()
+	}
+
+	_, _, err = SelectTyped[int, []int](e, context.TODO(), "none").Get(1).Exec()
+	if err == nil || err.Error() != E_not_found_any_collection_key {
+		t.Fail()
+	}
+
+	setted := map[int][]int{}
+	setter := func(key int, value []int) error {
+		setted[key] = value
+		return nil
+	}
+	if err := SelectTyped[int, []int](e, context.TODO(), "ints").Delete(1, setter); err != nil {
+		t.Fail()
+	}
+	if v, ok := setted[1]; !ok || v != nil {
+		t.Fail()
+	}
+}
+
+func TestSelectTypedManage(t *testing.T) {
+	e := Start(&CollectionConfig{Key: "tm", Capacity: 10})
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			e.AddCollection(&CollectionConfig{Key: "tm2", Capacity: 10})
+			e.RemoveCollection("tm2")
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			SelectTyped[int, int](e, context.TODO(), "tm").Upsert(i, i)
+		}
+	}()
+	wg.Wait()
+	e.Close(context.TODO())
+	_, _, err := SelectTyped[int, int](e, context.TODO(), "tm").Get(1).Exec()
+	if err == nil || err.Error() != E_engine_closed {
+		log.Print(err)
+		t.Fail()
+	}
+}
+
+func TestTypedSessionWithCtx(t *testing.T) {
+	e := Start(&CollectionConfig{Key: "typedctx", Capacity: 10})
+	defer e.Close(context.TODO())
+	type ctxKey struct{}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "req")
+	getter := func(ctx context.Context, key int) (string, error) {
+		if ctx.Value(ctxKey{}) != "req" {
+			return "", errors.New("no ctx")
+		}
+		if _, has := ctx.Deadline(); !has {
+			return "", errors.New("no deadline")
+		}
+		return "v1", nil
+	}
+	val, hit, err := SelectTyped[int, string](e, ctx, "typedctx").GetWith(1, getter).Exec()
+	if !hit || err != nil || val != "v1" {
+		log.Print(val, hit, err)
+		t.Fail()
+	}
+
+	cctx, cancel := context.WithCancel(ctx)
+	var setted int32
+	setter := func(ctx context.Context, key int, value string) error {
+		atomic.AddInt32(&setted, 1)
+		cancel()
+		return ctx.Err()
+	}
+	err = SelectTyped[int, string](e, cctx, "typedctx").UpsertWith(2, "v2", setter, setter)
+	if err == nil || err.Error() != E_cancelled || atomic.LoadInt32(&setted) != 1 {
+		log.Print(err, setted)
+		t.Fail()
+	}
+}
@@ -0,0 +1,260 @@
+package smartcache
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WriteItem is a write queued by write behind, Deleted is true when key was deleted
+type WriteItem struct {
+	Key     interface{}
+	Value   interface{}
+	Deleted bool
+}
+
+// BatchSetter write many items of collection to other storage at once
+type BatchSetter interface {
+	SetBatch(ctx context.Context, collection string, items []*WriteItem) error
+}
+
+// BatchSetterFunc is function implement BatchSetter
+type BatchSetterFunc func(ctx context.Context, collection string, items []*WriteItem) error
+
+func (f BatchSetterFunc) SetBatch(ctx context.Context, collection string, items []*WriteItem) error {
+	return f(ctx, collection, items)
+}
+
+// OverflowPolicy is what write behind do when queue is full
+type OverflowPolicy int
+
+const (
+	// OverflowBlock wait until queue has space or ctx is done
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest drop the new write and return E_write_queue_full
+	OverflowDropNewest
+	// OverflowDropOldest drop the oldest write in queue to keep the new one
+	OverflowDropOldest
+)
+
+type WriteBehindConfig struct {
+	Setter BatchSetter
+	// QueueSize is max number of keys wait to write, default 1000
+	QueueSize int
+	// BatchSize is max items of a SetBatch call, default 100
+	BatchSize int
+	// FlushInterval is max time a write wait when batch is not full, default 100ms
+	FlushInterval time.Duration
+	// Workers is number of goroutines call SetBatch, a key is always written by same worker. Default 1
+	Workers  int
+	Overflow OverflowPolicy
+	// OnError is called with items SetBatch failed to write, after retry of collection
+	OnError func(collection string, items []*WriteItem, err error)
+}
+
+/**
+writeQueue keep writes wait to flush in order, write to a key already in queue replace it.
+space is closed when items are taken, so blocked writers try again.
+*/
+type writeQueue struct {
+	lock    sync.Mutex
+	pending map[interface{}]*WriteItem
+	order   []interface{}
+	size    int
+	closed  bool
+	notify  chan struct{}
+	space   chan struct{}
+}
+
+func newWriteQueue(size int) *writeQueue {
+	return &writeQueue{
+		pending: make(map[interface{}]*WriteItem),
+		size:    size,
+		notify:  make(chan struct{}, 1),
+		space:   make(chan struct{}),
+	}
+}
+
+type writeBehind struct {
+	config *WriteBehindConfig
+	queues []*writeQueue
+}
+
+// startWriteBehind start workers flush writes of collection when WriteBehind is set
+func (c *Collection) startWriteBehind(config *WriteBehindConfig) {
+	if config == nil || config.Setter == nil {
+		return
+	}
+	cf := *config
+	if cf.Workers < 1 {
+		cf.Workers = 1
+	}
+	if cf.QueueSize < 1 {
+		cf.QueueSize = 1000
+	}
+	if cf.BatchSize < 1 {
+		cf.BatchSize = 100
+	}
+	if cf.FlushInterval <= 0 {
+		cf.FlushInterval = 100 * time.Millisecond
+	}
+	size := cf.QueueSize / cf.Workers
+	if size < 1 {
+		size = 1
+	}
+	wb := &writeBehind{config: &cf}
+	for i := 0; i < cf.Workers; i++ {
+		wb.queues = append(wb.queues, newWriteQueue(size))
+	}
+	c.writeBehind = wb
+	for _, q := range wb.queues {
+		c.workers.Add(1)
+		go c.writeWorker(q)
+	}
+}
+
+// queueWrite put write of key to write behind queue, it's noop when write behind is not set
+func (c *Collection) queueWrite(ctx context.Context, key, value interface{}, deleted bool) error {
+	if c.writeBehind == nil {
+		return nil
+	}
+	wb := c.writeBehind
+	q := wb.queues[hashKey(key)%uint64(len(wb.queues))]
+	item := &WriteItem{Key: key, Value: value, Deleted: deleted}
+	q.lock.Lock()
+	for {
+		if q.closed {
+			q.lock.Unlock()
+			return errors.New(E_write_behind_closed)
+		}
+		if _, has := q.pending[key]; has {
+			q.pending[key] = item
+			q.lock.Unlock()
+			atomic.AddUint64(&c.stats.writesCoalesced, 1)
+			return nil
+		}
+		if len(q.order) < q.size {
+			break
+		}
+		switch wb.config.Overflow {
+		case OverflowDropNewest:
+			q.lock.Unlock()
+			atomic.AddUint64(&c.stats.writeDrops, 1)
+			return errors.New(E_write_queue_full)
+		case OverflowDropOldest:
+			delete(q.pending, q.order[0])
+			q.order = q.order[1:]
+			atomic.AddUint64(&c.stats.writeDrops, 1)
+			continue
+		}
+		space := q.space
+		q.lock.Unlock()
+		if ctx == nil {
+			ctx = context.TODO()
+		}
+		select {
+		case <-space:
+		case <-ctx.Done():
+			return errors.New(E_cancelled)
+		}
+		q.lock.Lock()
+	}
+	q.pending[key] = item
+	q.order = append(q.order, key)
+	full := len(q.order) >= wb.config.BatchSize
+	q.lock.Unlock()
+	if full {
+		select {
+		case q.notify <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// take remove at most n writes from head of queue
+func (q *writeQueue) take(n int) []*WriteItem {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if n > len(q.order) {
+		n = len(q.order)
+	}
+	if n == 0 {
+		return nil
+	}
+	items := make([]*WriteItem, 0, n)
+	for _, key := range q.order[:n] {
+		items = append(items, q.pending[key])
+		delete(q.pending, key)
+	}
+	q.order = q.order[n:]
+	close(q.space)
+	q.space = make(chan struct{})
+	return items
+}
+
+func (q *writeQueue) len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return len(q.order)
+}
+
+func (c *Collection) writeWorker(q *writeQueue) {
+	defer c.workers.Done()
+	tick := time.NewTicker(c.writeBehind.config.FlushInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-q.notify:
+		case <-tick.C:
+		case <-c.stop:
+			// writes after close are refused, writes queued are drained
+			q.lock.Lock()
+			q.closed = true
+			close(q.space)
+			q.space = make(chan struct{})
+			q.lock.Unlock()
+			c.flushQueue(q)
+			return
+		}
+		c.flushQueue(q)
+	}
+}
+
+// flushQueue write all items in queue by batches
+func (c *Collection) flushQueue(q *writeQueue) {
+	cf := c.writeBehind.config
+	for {
+		items := q.take(cf.BatchSize)
+		if len(items) == 0 {
+			return
+		}
+		err := c.retry.do(context.Background(), &c.stats.setterRetries, func() error {
+			return cf.Setter.SetBatch(context.Background(), c.key, items)
+		})
+		atomic.AddUint64(&c.stats.writeBatches, 1)
+		if err != nil {
+			atomic.AddUint64(&c.stats.writeFailures, uint64(len(items)))
+			if cf.OnError != nil {
+				cf.OnError(c.key, items, err)
+			} else {
+				log.Print("write behind: ", c.key, " lost ", len(items), " items ", err)
+			}
+		}
+	}
+}
+
+// writeQueued is number of writes wait to flush
+func (c *Collection) writeQueued() int {
+	if c.writeBehind == nil {
+		return 0
+	}
+	n := 0
+	for _, q := range c.writeBehind.queues {
+		n += q.len()
+	}
+	return n
+}
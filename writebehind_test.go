@@ -0,0 +1,133 @@
+package smartcache
+
+import (
+	"context"
+	"log"
+	"sync"
+	"testing"
+	"time"
+)
+
+type memBatchSetter struct {
+	lock    sync.Mutex
+	batches int
+	data    map[interface{}]interface{}
+}
+
+func (m *memBatchSetter) SetBatch(ctx context.Context, collection string, items []*WriteItem) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.batches++
+	for _, item := range items {
+		if item.Deleted {
+			delete(m.data, item.Key)
+			continue
+		}
+		m.data[item.Key] = item.Value
+	}
+	return nil
+}
+
+func (m *memBatchSetter) get(key interface{}) (interface{}, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	val, has := m.data[key]
+	return val, has
+}
+
+func TestWriteBehind(t *testing.T) {
+	db := &memBatchSetter{data: make(map[interface{}]interface{})}
+	e := Start(&CollectionConfig{
+		Key: "wb", Capacity: 100, ExpireDuration: 10 * time.Second,
+		WriteBehind: &WriteBehindConfig{Setter: db, BatchSize: 10, FlushInterval: 50 * time.Millisecond},
+	})
+	for i := 0; i < 5; i++ {
+		e.Select(context.TODO(), "wb").Upsert("k1", i)
+	}
+	e.Select(context.TODO(), "wb").Upsert("k2", 2)
+	e.Select(context.TODO(), "wb").Upsert("k3", 3)
+	e.Select(context.TODO(), "wb").Delete("k3")
+	// cache is updated at once, storage later
+	var out int
+	if hit, _ := e.Select(context.TODO(), "wb").Get("k1", nil).Exec(&out); !hit || out != 4 {
+		t.Fail()
+	}
+	if _, has := db.get("k1"); has {
+		t.Fail()
+	}
+	stats := e.Collection()["wb"].Stats()
+	if stats.WriteQueued != 3 || stats.WritesCoalesced != 5 {
+		log.Printf("%+v", stats)
+		t.Fail()
+	}
+	time.Sleep(100 * time.Millisecond)
+	if val, _ := db.get("k1"); val != 4 {
+		t.Fail()
+	}
+	if _, has := db.get("k3"); has {
+		t.Fail()
+	}
+	if db.batches != 1 {
+		log.Print(db.batches)
+		t.Fail()
+	}
+
+	// close drain queue
+	e.Select(context.TODO(), "wb").Upsert("k4", 4)
+	e.Close(context.TODO())
+	if val, _ := db.get("k4"); val != 4 {
+		t.Fail()
+	}
+	if err := e.Collection()["wb"].Upsert(context.TODO(), "k5", 5); err == nil || err.Error() != E_write_behind_closed {
+		t.Fail()
+	}
+}
+
+func TestWriteBehindOverflow(t *testing.T) {
+	db := &memBatchSetter{data: make(map[interface{}]interface{})}
+	e := Start(
+		&CollectionConfig{
+			Key: "drop", Capacity: 100, ExpireDuration: 10 * time.Second,
+			WriteBehind: &WriteBehindConfig{Setter: db, QueueSize: 2, FlushInterval: time.Hour, Overflow: OverflowDropNewest},
+		},
+		&CollectionConfig{
+			Key: "oldest", Capacity: 100, ExpireDuration: 10 * time.Second,
+			WriteBehind: &WriteBehindConfig{Setter: db, QueueSize: 2, FlushInterval: time.Hour, Overflow: OverflowDropOldest},
+		},
+		&CollectionConfig{
+			Key: "block", Capacity: 100, ExpireDuration: 10 * time.Second,
+			WriteBehind: &WriteBehindConfig{Setter: db, QueueSize: 2, FlushInterval: 50 * time.Millisecond},
+		},
+	)
+	for _, key := range []string{"drop", "oldest", "block"} {
+		e.Select(context.TODO(), key).Upsert(key+"1", 1)
+		e.Select(context.TODO(), key).Upsert(key+"2", 2)
+	}
+	if err := e.Select(context.TODO(), "drop").Upsert("drop3", 3); err == nil || err.Error() != E_write_queue_full {
+		t.Fail()
+	}
+	if err := e.Select(context.TODO(), "oldest").Upsert("oldest3", 3); err != nil {
+		t.Fail()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := e.Select(ctx, "block").Upsert("block3", 3); err == nil || err.Error() != E_cancelled {
+		t.Fail()
+	}
+	// wait flush make space
+	start := time.Now()
+	if err := e.Select(context.TODO(), "block").Upsert("block4", 4); err != nil || time.Since(start) < 20*time.Millisecond {
+		log.Print(err, time.Since(start))
+		t.Fail()
+	}
+	e.Close(context.TODO())
+	for key, want := range map[string]bool{"drop1": true, "drop3": false, "oldest1": false, "oldest3": true, "block4": true} {
+		if _, has := db.get(key); has != want {
+			log.Print(key)
+			t.Fail()
+		}
+	}
+	if e.Collection()["oldest"].Stats().WriteDrops != 1 {
+		t.Fail()
+	}
+}
@@ -0,0 +1,52 @@
+package smartcache
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SetterFailure is error of a setter, Index is position of setter in call
+type SetterFailure struct {
+	Index int
+	Err   error
+}
+
+/**
+SetterError is returned when some setters of Upsert, Delete failed.
+CacheChanged is false with CollectionConfig.WriteThrough, setters run before cache is changed.
+*/
+type SetterError struct {
+	Collection   string
+	Key          interface{}
+	Failures     []SetterFailure
+	CacheChanged bool
+}
+
+// Error is errors of all setters, same as before SetterError exist
+func (e *SetterError) Error() string {
+	var b strings.Builder
+	for _, f := range e.Failures {
+		b.WriteString(f.Err.Error())
+	}
+	return b.String()
+}
+
+// Unwrap return error of first setter failed
+func (e *SetterError) Unwrap() error {
+	if len(e.Failures) == 0 {
+		return nil
+	}
+	return e.Failures[0].Err
+}
+
+func (e *SetterError) String() string {
+	parts := make([]string, 0, len(e.Failures))
+	for _, f := range e.Failures {
+		parts = append(parts, fmt.Sprintf("setter %d: %v", f.Index, f.Err))
+	}
+	return fmt.Sprintf("%s.%v: %s", e.Collection, e.Key, strings.Join(parts, ", "))
+}
+
+func (e *SetterError) add(index int, err error) {
+	e.Failures = append(e.Failures, SetterFailure{Index: index, Err: err})
+}
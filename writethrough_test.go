@@ -0,0 +1,73 @@
+package smartcache
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWriteThrough(t *testing.T) {
+	e := Start(&CollectionConfig{Key: "wt", Capacity: 10, ExpireDuration: 10 * time.Second, WriteThrough: true})
+	ok := func(k, v interface{}) error { return nil }
+	dbErr := errors.New("db down")
+	fail := func(k, v interface{}) error { return dbErr }
+
+	e.Select(context.TODO(), "wt").Upsert("k1", 1, ok)
+	err := e.Select(context.TODO(), "wt").Upsert("k1", 2, ok, fail)
+	serr, is := err.(*SetterError)
+	if !is || len(serr.Failures) != 1 || serr.Failures[0].Index != 1 || serr.CacheChanged || !errors.Is(err, dbErr) {
+		log.Print(err)
+		t.Fail()
+	}
+	var out int
+	if hit, _ := e.Select(context.TODO(), "wt").Get("k1", nil).Exec(&out); !hit || out != 1 {
+		log.Print(out)
+		t.Fail()
+	}
+	if err := e.Select(context.TODO(), "wt").Delete("k1", fail); err == nil {
+		t.Fail()
+	}
+	if !e.Collection()["wt"].IsKeyExisted("k1") {
+		t.Fail()
+	}
+	if err := e.Select(context.TODO(), "wt").Delete("k1", ok); err != nil || e.Collection()["wt"].IsKeyExisted("k1") {
+		t.Fail()
+	}
+}
+
+func TestSetterErrorNotWriteThrough(t *testing.T) {
+	e := Start(&CollectionConfig{Key: "nwt", Capacity: 10, ExpireDuration: 10 * time.Second})
+	err := e.Select(context.TODO(), "nwt").Upsert("k1", 1, func(k, v interface{}) error { return errors.New("a") }, func(k, v interface{}) error { return errors.New("b") })
+	serr, is := err.(*SetterError)
+	if !is || !serr.CacheChanged || err.Error() != "ab" || len(serr.Failures) != 2 {
+		log.Print(err)
+		t.Fail()
+	}
+	if !e.Collection()["nwt"].IsKeyExisted("k1") {
+		t.Fail()
+	}
+}
+
+func TestTypedWriteThroughCancel(t *testing.T) {
+	e := Start(&CollectionConfig{Key: "twt", Capacity: 10, WriteThrough: true})
+	defer e.Close(context.TODO())
+	ctx, cancel := context.WithCancel(context.Background())
+	var called int32
+	setter := func(key string, value int) error {
+		atomic.AddInt32(&called, 1)
+		cancel()
+		return nil
+	}
+	err := SelectTyped[string, int](e, ctx, "twt").Upsert("k1", 1, setter, setter)
+	if err == nil || err.Error() != E_cancelled || atomic.LoadInt32(&called) != 1 {
+		log.Print(err, called)
+		t.Fail()
+	}
+	// cache is not changed when write through is cancelled
+	if e.Collection()["twt"].IsKeyExisted("k1") {
+		t.Fail()
+	}
+}